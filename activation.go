@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// listenFdsStart is the first file descriptor passed by the service
+// manager, as described in sd_listen_fds(3).
+const listenFdsStart = 3
+
+// activationListeners returns the listening sockets passed by the service
+// manager through $LISTEN_FDS, or nil if there are none for this process.
+// The environment variables are unset so that they are not inherited by
+// child processes.
+func activationListeners() ([]net.Listener, error) {
+	if pid := os.Getenv("LISTEN_PID"); pid == "" || pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("Invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+	var listeners []net.Listener
+	for fd := listenFdsStart; fd < listenFdsStart+n; fd++ {
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Inherited file descriptor %d: %v", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// activationInputs selects the inherited Unix socket listener for each
+// input: the one listening on the input path if any, otherwise, for a
+// single input, the only one passed. It returns a nil listener for each
+// input without one, and closes any listeners not selected. It is an
+// error if listeners were passed but none was selected.
+func activationInputs(inputs []dnstapInput) ([]net.Listener, error) {
+	listeners, err := activationListeners()
+	if err != nil || len(listeners) == 0 {
+		return make([]net.Listener, len(inputs)), err
+	}
+	var unix []net.Listener
+	for _, l := range listeners {
+		if l.Addr().Network() == "unix" {
+			unix = append(unix, l)
+		} else {
+			l.Close()
+		}
+	}
+	sel := make([]net.Listener, len(inputs))
+	used := make(map[net.Listener]bool)
+	for n, i := range inputs {
+		for _, l := range unix {
+			if i != "" && l.Addr().String() == string(i) {
+				sel[n] = l
+				used[l] = true
+			}
+		}
+	}
+	if len(inputs) == 1 && sel[0] == nil && len(unix) == 1 {
+		sel[0] = unix[0]
+		used[unix[0]] = true
+	}
+	for _, l := range unix {
+		if !used[l] {
+			l.Close()
+		}
+	}
+	if len(used) == 0 {
+		return nil, fmt.Errorf("No inherited Unix socket for input %q among %d passed",
+			inputNames(inputs), len(listeners))
+	}
+	return sel, nil
+}
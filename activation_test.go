@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestActivationHelper runs in a child process started by
+// TestActivation with an inherited listener on file descriptor 3.
+func TestActivationHelper(t *testing.T) {
+	path := os.Getenv("ACTIVATION_TEST_INPUT")
+	if path == "" {
+		t.Skip("helper process")
+	}
+	sel, err := activationInputs([]dnstapInput{dnstapInput(path)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := sel[0]
+	if l == nil {
+		t.Fatal("no inherited listener")
+	}
+	if l.Addr().String() != path {
+		t.Fatalf("listener on %s, expected %s", l.Addr(), path)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("LISTEN_FDS not unset")
+	}
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if _, err := l.Accept(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestActivation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "activation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dnstap.sock")
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := l.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// The shell's exec preserves its process ID for LISTEN_PID.
+	cmd := exec.Command("/bin/sh", "-c",
+		`LISTEN_PID=$$ LISTEN_FDS=1 exec "$0" -test.run=TestActivationHelper -test.v`,
+		os.Args[0])
+	cmd.Env = append(os.Environ(), "ACTIVATION_TEST_INPUT="+path)
+	cmd.ExtraFiles = []*os.File{f}
+	out, err := cmd.CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "--- PASS: TestActivationHelper") {
+		t.Errorf("helper failed: %v\n%s", err, out)
+	}
+}
+
+func TestActivationNotPassed(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "1")
+	sel, err := activationInputs([]dnstapInput{"/tmp/dnstap.sock"})
+	if len(sel) != 1 || sel[0] != nil || err != nil {
+		t.Errorf("activationInputs() = %v, %v, expected no listener", sel, err)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/farsightsec/go-config"
+)
+
+// apiKeyInterval is how often an API key file is checked for changes.
+const apiKeyInterval = 10 * time.Second
+
+var errEmptyAPIKey = errors.New("empty API key")
+
+// keyFingerprint returns a short, non-reversible identifier of an API key
+// for logging.
+func keyFingerprint(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:4])
+}
+
+// apiKeyFile returns the path of the file the API key was read from, or
+// the empty string if it was given directly.
+func apiKeyFile(key *config.String) string {
+	v, _ := key.MarshalYAML()
+	source, _ := v.(string)
+	for _, prefix := range []string{"/", "./", "../"} {
+		if strings.HasPrefix(source, prefix) {
+			return source
+		}
+	}
+	return ""
+}
+
+// watchAPIKey re-reads the API key file every interval, and applies the
+// key when it changes, until stop is closed.
+func (ctx *Context) watchAPIKey(interval time.Duration, stop <-chan struct{}) {
+	var failed bool
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		conf := ctx.config()
+		path := apiKeyFile(&conf.APIKey)
+		if path == "" {
+			continue
+		}
+		var key config.String
+		err := key.Set(path)
+		if err == nil && key.String() == "" {
+			err = errEmptyAPIKey
+		}
+		if err != nil && !failed {
+			if os.IsPermission(err) {
+				// Likely after dropping privileges with user or group.
+				logError("Permission denied reading API key file, keeping current key",
+					"file", path, "user", conf.User, "group", conf.Group, "error", err)
+			} else {
+				logWarn("Could not read API key file, keeping current key",
+					"file", path, "error", err)
+			}
+		}
+		if err != nil {
+			failed = true
+			continue
+		}
+		failed = false
+		if key.String() == conf.APIKey.String() {
+			continue
+		}
+
+		ctx.mu.Lock()
+		if ctx.Config != conf {
+			// Reloaded meanwhile; check again next time.
+			ctx.mu.Unlock()
+			continue
+		}
+		c := *conf
+		c.APIKey = key
+		ctx.Config = &c
+		ctx.mu.Unlock()
+		ctx.setAPIKey(conf.APIKey.String(), key.String())
+	}
+}
+
+// setAPIKey uses key for subsequent server connections. Open connections
+// remain authenticated with the previous key until they reconnect.
+func (ctx *Context) setAPIKey(old, key string) {
+	sc, ok := ctx.Client.(*sensorClient)
+	if !ok {
+		return
+	}
+	sc.SetAPIKey(key)
+	logInfo("API key changed, using new key at next server connection",
+		"old_key", keyFingerprint(old), "key", keyFingerprint(key))
+}
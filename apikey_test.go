@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farsightsec/sielink/client"
+)
+
+func TestSetAPIKey(t *testing.T) {
+	logs := new(bytes.Buffer)
+	defaultLogger.SetOutput(logs)
+	defer defaultLogger.SetOutput(os.Stderr)
+
+	sc := newClient(&client.Config{APIKey: "old-key"}, nil)
+	ctx := &Context{Client: sc}
+	ctx.setAPIKey("old-key", "new-key")
+	if sc.APIKey != "new-key" {
+		t.Errorf("client API key %q not replaced", sc.APIKey)
+	}
+	if strings.Contains(logs.String(), "-key") {
+		t.Errorf("API key logged: %s", logs)
+	}
+	if !strings.Contains(logs.String(), keyFingerprint("new-key")) {
+		t.Errorf("fingerprint not logged: %s", logs)
+	}
+}
+
+func TestWatchAPIKey(t *testing.T) {
+	defaultLogger.SetOutput(ioutil.Discard)
+	defer defaultLogger.SetOutput(os.Stderr)
+
+	fname := filepath.Join(t.TempDir(), "apikey")
+	if err := ioutil.WriteFile(fname, []byte("old-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	conf := new(Config)
+	if err := conf.APIKey.Set(fname); err != nil {
+		t.Fatal(err)
+	}
+	if f := apiKeyFile(&conf.APIKey); f != fname {
+		t.Fatalf("key file %q, expected %q", f, fname)
+	}
+	sc := newClient(&client.Config{APIKey: conf.APIKey.String()}, nil)
+	ctx := &Context{Config: conf, Client: sc}
+	stop := make(chan struct{})
+	defer close(stop)
+	go ctx.watchAPIKey(10*time.Millisecond, stop)
+
+	// An empty key file leaves the current key in place.
+	if err := ioutil.WriteFile(fname, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if key := ctx.config().APIKey.String(); key != "old-key" {
+		t.Fatalf("key %q replaced by empty key file", key)
+	}
+
+	if err := ioutil.WriteFile(fname, []byte("new-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for ctx.config().APIKey.String() != "new-key" {
+		if time.Now().After(deadline) {
+			t.Fatal("key file change not applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.APIKey != "new-key" {
+		t.Errorf("client API key %q not replaced", sc.APIKey)
+	}
+}
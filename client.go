@@ -0,0 +1,344 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/websocket"
+
+	"github.com/farsightsec/sielink"
+	"github.com/farsightsec/sielink/client"
+	"github.com/farsightsec/sielink/rawlink"
+)
+
+// sensorClient is a sielink client.Client which can reach servers through
+// an HTTP CONNECT proxy. Apart from proxy support, it dials servers the
+// same way as the client returned by client.NewClient.
+type sensorClient struct {
+	*rawlink.Link
+	client.Config
+	proxy func(*url.URL) (*url.URL, error)
+
+	mu        sync.Mutex
+	connected map[string]bool
+	conns     map[string]*websocket.Conn
+	removed   map[string]bool
+}
+
+func newClient(conf *client.Config, proxy func(*url.URL) (*url.URL, error)) *sensorClient {
+	rl := rawlink.NewLink()
+	rl.Heartbeat = conf.Heartbeat
+	return &sensorClient{
+		Link:      rl,
+		Config:    *conf,
+		proxy:     proxy,
+		connected: make(map[string]bool),
+		conns:     make(map[string]*websocket.Conn),
+		removed:   make(map[string]bool),
+	}
+}
+
+// Connected returns true if a connection to the server at uri is open.
+func (c *sensorClient) Connected(uri string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected[uri]
+}
+
+// anyConnected returns true if a connection to any server is open.
+func (c *sensorClient) anyConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.conns) > 0
+}
+
+func (c *sensorClient) setConnected(uri string, connected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connected[uri] = connected
+}
+
+func (c *sensorClient) Subscribe(channels ...uint32) {
+	c.SetSubscription([]*sielink.Subscription{
+		&sielink.Subscription{Channel: channels},
+	})
+}
+
+func (c *sensorClient) DialAndHandle(serverurl string) error {
+	conf, err := websocket.NewConfig(serverurl, c.URL)
+	if err != nil {
+		return err
+	}
+	conf.TlsConfig = c.TLSConfig
+	c.mu.Lock()
+	apiKey := c.APIKey
+	c.mu.Unlock()
+	if apiKey != "" {
+		conf.Header.Set("X-API-Key", apiKey)
+	}
+
+	conn, err := c.dialConfig(conf)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.removed[serverurl] {
+		c.mu.Unlock()
+		conn.Close()
+		return errServerRemoved
+	}
+	c.connected[serverurl] = true
+	c.conns[serverurl] = conn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.connected[serverurl] = false
+		delete(c.conns, serverurl)
+		c.mu.Unlock()
+	}()
+	return c.HandleConnection(conn)
+}
+
+var errServerRemoved = errors.New("server removed")
+
+// redactedURI returns the server uri with any password replaced, for
+// logs and metric labels.
+func redactedURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.User == nil {
+		return uri
+	}
+	if _, ok := u.User.Password(); !ok {
+		return uri
+	}
+	return u.Redacted()
+}
+
+// SetAPIKey sets the API key used to authenticate subsequent connections.
+func (c *sensorClient) SetAPIKey(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.APIKey = key
+}
+
+// Disconnect closes any connection to the server at uri and prevents
+// further connections until the server is added again with Connect.
+func (c *sensorClient) Disconnect(uri string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removed[uri] = true
+	if conn := c.conns[uri]; conn != nil {
+		conn.Close()
+	}
+}
+
+// Connect allows connections to a server removed with Disconnect.
+func (c *sensorClient) Connect(uri string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.removed, uri)
+}
+
+// proxyURL returns the proxy to use for a connection to the given server,
+// or nil if the connection should be made directly.
+func (c *sensorClient) proxyURL(u *url.URL) (*url.URL, error) {
+	if c.proxy == nil {
+		return nil, nil
+	}
+	hu := *u
+	switch u.Scheme {
+	case "ws":
+		hu.Scheme = "http"
+	case "wss":
+		hu.Scheme = "https"
+	}
+	return c.proxy(&hu)
+}
+
+func (c *sensorClient) dialConfig(conf *websocket.Config) (conn *websocket.Conn, err error) {
+	port := uint16(80)
+	useTLS := false
+	service := "http"
+
+	scheme := conf.Location.Scheme
+	switch scheme {
+	case "ws":
+	case "wss":
+		port = uint16(443)
+		useTLS = true
+		service = "https"
+	default:
+		return nil, fmt.Errorf("Invalid uri scheme %s", scheme)
+	}
+
+	proxy, err := c.proxyURL(conf.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	var serverName string
+	if proxy != nil {
+		// Leave name resolution to the proxy.
+		serverName = conf.Location.Hostname()
+		addrs = []string{net.JoinHostPort(serverName, fmt.Sprint(port))}
+		if conf.Location.Port() != "" {
+			addrs[0] = conf.Location.Host
+		}
+	} else {
+		addrs, serverName, err = getAddrs(conf.Location.Host, service, port)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, addr := range addrs {
+		var c net.Conn
+
+		if proxy != nil {
+			c, err = dialProxy(proxy, addr)
+		} else {
+			c, err = net.Dial("tcp", addr)
+		}
+		if err != nil {
+			continue
+		}
+
+		if useTLS {
+			tlsc := new(tls.Config)
+			if conf.TlsConfig != nil {
+				tlsc = conf.TlsConfig.Clone()
+			}
+			tlsc.ServerName = serverName
+			tc := tls.Client(c, tlsc)
+			if err = tc.Handshake(); err != nil {
+				c.Close()
+				continue
+			}
+			c = tc
+		}
+
+		conn, err = websocket.NewClient(conf, c)
+		break
+	}
+	return
+}
+
+// getAddrs returns the addresses to try for a server name, using SRV
+// records for the service if the name does not include a port.
+func getAddrs(name, service string, port uint16) (addrs []string, cn string, err error) {
+	host, sport, err := net.SplitHostPort(name)
+	if err == nil {
+		addrs = []string{net.JoinHostPort(host, sport)}
+		cn = host
+		return
+	}
+
+	cn = name
+	_, srvs, err := net.LookupSRV(service, "tcp", name)
+	if err == nil {
+		for _, s := range srvs {
+			addrs = append(addrs, fmt.Sprintf("%s:%d", s.Target, s.Port))
+		}
+		return
+	}
+
+	if t, ok := err.(*net.DNSError); ok && t.Temporary() {
+		return
+	}
+
+	addrs = []string{fmt.Sprintf("%s:%d", name, port)}
+	err = nil
+	return
+}
+
+const proxyTimeout = 30 * time.Second
+
+// bufferedConn is a net.Conn whose reads are served from a bufio.Reader
+// which may hold data read past the proxy's CONNECT response.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (bc *bufferedConn) Read(b []byte) (int, error) {
+	return bc.r.Read(b)
+}
+
+// dialProxy opens a tunnel to addr through the HTTP proxy at proxy with
+// the CONNECT method, authenticating with the proxy URL's user info, if any.
+func dialProxy(proxy *url.URL, addr string) (net.Conn, error) {
+	if proxy.Scheme != "http" {
+		return nil, fmt.Errorf("proxy %s: unsupported scheme %s",
+			proxy.Redacted(), proxy.Scheme)
+	}
+	paddr := proxy.Host
+	if proxy.Port() == "" {
+		paddr = net.JoinHostPort(proxy.Hostname(), "80")
+	}
+	conn, err := net.DialTimeout("tcp", paddr, proxyTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := proxy.User; u != nil {
+		pass, _ := u.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+
+			base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+pass)))
+	}
+
+	conn.SetDeadline(time.Now().Add(proxyTimeout))
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %v", proxy.Redacted(), err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: CONNECT %s: %s",
+			proxy.Redacted(), addr, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return &bufferedConn{conn, br}, nil
+}
+
+// proxyFunc returns a function selecting the proxy for a server URL. The
+// configured proxy, if any, overrides the HTTPS_PROXY and HTTP_PROXY
+// environment variables. NO_PROXY is honored in either case.
+func proxyFunc(conf *Config) func(*url.URL) (*url.URL, error) {
+	pc := httpproxy.FromEnvironment()
+	if conf.Proxy.URL != nil {
+		pc.HTTPProxy = conf.Proxy.String()
+		pc.HTTPSProxy = conf.Proxy.String()
+	}
+	return pc.ProxyFunc()
+}
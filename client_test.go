@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/websocket"
+
+	"github.com/farsightsec/sielink"
+	"github.com/farsightsec/sielink/client"
+	"github.com/farsightsec/sielink/rawlink"
+)
+
+// testProxy is a minimal HTTP CONNECT proxy which tunnels all requests
+// to backend, recording the requests it receives.
+type testProxy struct {
+	net.Listener
+	backend  string
+	auth     string
+	requests chan *http.Request
+}
+
+func newTestProxy(t *testing.T, backend, auth string) *testProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProxy{l, backend, auth, make(chan *http.Request, 10)}
+	go p.serve()
+	return p
+}
+
+func (p *testProxy) serve() {
+	for {
+		c, err := p.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(c)
+	}
+}
+
+func (p *testProxy) handle(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return
+	}
+	p.requests <- req
+	if req.Method != http.MethodConnect {
+		io.WriteString(c, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+		return
+	}
+	if p.auth != "" && req.Header.Get("Proxy-Authorization") != p.auth {
+		io.WriteString(c, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		return
+	}
+	bc, err := net.Dial("tcp", p.backend)
+	if err != nil {
+		io.WriteString(c, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer bc.Close()
+	io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+	go io.Copy(bc, br)
+	io.Copy(c, bc)
+}
+
+func proxyTo(p *url.URL) func(*url.URL) (*url.URL, error) {
+	return func(*url.URL) (*url.URL, error) { return p, nil }
+}
+
+func TestProxyUpload(t *testing.T) {
+	server := rawlink.NewLink()
+	apiKeys := make(chan string, 1)
+	backend := httptest.NewServer(websocket.Handler(func(c *websocket.Conn) {
+		apiKeys <- c.Request().Header.Get("X-API-Key")
+		server.HandleConnection(c)
+	}))
+	defer backend.Close()
+	defer server.Close()
+
+	proxy := newTestProxy(t, backend.Listener.Addr().String(),
+		"Basic dXNlcjpwYXNz") // user:pass
+	defer proxy.Close()
+
+	cconf := &client.Config{
+		Heartbeat: time.Second,
+		URL:       "http://localhost/dnstap-client",
+		APIKey:    "foo",
+	}
+	pu := &url.URL{Scheme: "http", Host: proxy.Addr().String(),
+		User: url.UserPassword("user", "pass")}
+	c := newClient(cconf, proxyTo(pu))
+	defer c.Close()
+	go c.DialAndHandle("ws://relay.example:8080/session/dnstap-sensor-upload")
+
+	req := <-proxy.requests
+	if req.Method != http.MethodConnect || req.Host != "relay.example:8080" {
+		t.Fatalf("unexpected proxy request %s %s", req.Method, req.Host)
+	}
+	if key := <-apiKeys; key != "foo" {
+		t.Errorf("server received API key %q", key)
+	}
+
+	go c.Send(&sielink.Payload{Channel: proto.Uint32(203), Data: []byte("test")})
+	select {
+	case p := <-server.Receive():
+		if string(p.GetData()) != "test" || p.GetChannel() != 203 {
+			t.Errorf("received unexpected payload %v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for payload")
+	}
+}
+
+func TestProxyAuthFailure(t *testing.T) {
+	proxy := newTestProxy(t, "127.0.0.1:1", "Basic dXNlcjpwYXNz")
+	defer proxy.Close()
+
+	pu := &url.URL{Scheme: "http", Host: proxy.Addr().String(),
+		User: url.UserPassword("user", "wrong")}
+	_, err := dialProxy(pu, "relay.example:443")
+	if err == nil {
+		t.Fatal("proxy accepted invalid credentials")
+	}
+	t.Log(err)
+}
+
+func TestProxySelection(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Proxy  string
+		Env    map[string]string
+		Server string
+		Expect string
+	}{
+		{"no proxy", "", nil, "wss://submit.example/", ""},
+		{"env https", "",
+			map[string]string{"HTTPS_PROXY": "http://env-proxy:3128"},
+			"wss://submit.example/", "http://env-proxy:3128"},
+		{"env http for ws", "",
+			map[string]string{"HTTPS_PROXY": "http://env-proxy:3128"},
+			"ws://submit.example/", ""},
+		{"config overrides env", "http://conf-proxy:8080",
+			map[string]string{"HTTPS_PROXY": "http://env-proxy:3128"},
+			"wss://submit.example/", "http://conf-proxy:8080"},
+		{"config for ws", "http://conf-proxy:8080", nil,
+			"ws://submit.example/", "http://conf-proxy:8080"},
+		{"no_proxy", "http://conf-proxy:8080",
+			map[string]string{"NO_PROXY": ".example"},
+			"wss://submit.example/", ""},
+	}
+
+	for _, tc := range testCases {
+		for _, v := range []string{"HTTPS_PROXY", "https_proxy",
+			"HTTP_PROXY", "http_proxy", "NO_PROXY", "no_proxy"} {
+			t.Setenv(v, "")
+		}
+		for k, v := range tc.Env {
+			t.Setenv(k, v)
+		}
+		conf := new(Config)
+		if tc.Proxy != "" {
+			conf.Proxy.Set(tc.Proxy)
+		}
+		c := newClient(&client.Config{}, proxyFunc(conf))
+		su, _ := url.Parse(tc.Server)
+		pu, err := c.proxyURL(su)
+		if err != nil {
+			t.Errorf("%s: %v", tc.Name, err)
+			continue
+		}
+		var got string
+		if pu != nil {
+			got = pu.String()
+		}
+		if got != tc.Expect {
+			t.Errorf("%s: proxy %q, expected %q", tc.Name, got, tc.Expect)
+		}
+	}
+}
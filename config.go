@@ -12,7 +12,13 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 
@@ -22,20 +28,141 @@ import (
 
 // Config represents the global configuration of the client.
 type Config struct {
-	Servers       []config.URL    `yaml:"servers"`
-	UDPOutput     config.UDPAddr  `yaml:"udp_output"`
-	MTU           int             `yaml:"mtu"`
-	APIKey        config.String   `yaml:"api_key"`
-	Channel       uint32          `yaml:"channel"`
-	DnstapInput   dnstapInput     `yaml:"dnstap_input"`
-	StatsInterval config.Duration `yaml:"stats_interval"`
-	Heartbeat     config.Duration `yaml:"heartbeat"`
-	Retry         config.Duration `yaml:"retry"`
-	Flush         config.Duration `yaml:"flush"`
-	Trace         bool            `yaml:"-"`
-	FilterQnames  nameFilter      `yaml:"filter_qnames"`
+	Servers         []config.URL      `yaml:"servers"`
+	UDPOutput       config.UDPAddr    `yaml:"udp_output"`
+	UDPOutputs      udpOutputList     `yaml:"udp_outputs"`
+	ShardedOutputs  shardedOutputList `yaml:"sharded_outputs"`
+	Pipelines       pipelineList      `yaml:"pipelines"`
+	MTU             int               `yaml:"mtu"`
+	APIKey          config.String     `yaml:"api_key"`
+	Channel         uint32            `yaml:"channel"`
+	DnstapInput     dnstapInput       `yaml:"dnstap_input"`
+	InputMode       socketMode        `yaml:"input_socket_mode"`
+	InputGroup      string            `yaml:"input_socket_group"`
+	InputRemove     *bool             `yaml:"input_socket_remove"`
+	User            string            `yaml:"user"`
+	Group           string            `yaml:"group"`
+	StatsInterval   config.Duration   `yaml:"stats_interval"`
+	Heartbeat       config.Duration   `yaml:"heartbeat"`
+	Retry           config.Duration   `yaml:"retry"`
+	Flush           config.Duration   `yaml:"flush"`
+	Trace           bool              `yaml:"trace"`
+	TraceSample     int               `yaml:"trace_sample"`
+	TraceRate       int               `yaml:"trace_rate"`
+	TraceQnames     nameFilter        `yaml:"trace_qnames"`
+	TraceFile       string            `yaml:"trace_file"`
+	FilterQnames    nameFilter        `yaml:"filter_qnames"`
+	TLSCAFile       string            `yaml:"tls_ca_file"`
+	TLSCertFile     string            `yaml:"tls_cert_file"`
+	TLSKeyFile      string            `yaml:"tls_key_file"`
+	TLSPins         stringList        `yaml:"tls_pin_sha256"`
+	Proxy           config.URL        `yaml:"proxy"`
+	MetricsListen   string            `yaml:"metrics_listen"`
+	InputIdle       config.Duration   `yaml:"input_idle"`
+	ShutdownTimeout config.Duration   `yaml:"shutdown_timeout"`
+	LogLevel        logLevel          `yaml:"log_level"`
+	LogFormat       string            `yaml:"log_format"`
+	CheckConfig     bool              `yaml:"-"`
+	PrintConfig     bool              `yaml:"-"`
+	PrintSchema     bool              `yaml:"-"`
+
+	// sources records where each setting not left at its default
+	// was taken from.
+	sources map[string]string
+}
+
+// setSource records that the setting key was taken from source.
+func (conf *Config) setSource(key, source string) {
+	if conf.sources == nil {
+		conf.sources = make(map[string]string)
+	}
+	if key == "udp_output" {
+		// Merged into udp_outputs.
+		key = "udp_outputs"
+	}
+	conf.sources[key] = source
+}
+
+// Source returns where the setting key was taken from.
+func (conf *Config) Source(key string) string {
+	if src, ok := conf.sources[key]; ok {
+		return src
+	}
+	return "default"
+}
+
+// flagKeys maps command line options to the configuration keys they
+// set, where the names differ.
+var flagKeys = map[string]string{
+	"apikey":         "api_key",
+	"input":          "dnstap_input",
+	"filter_qname":   "filter_qnames",
+	"trace_qname":    "trace_qnames",
+	"udp_output":     "udp_outputs",
+	"sharded_output": "sharded_outputs",
+	"pipeline":       "pipelines",
 }
 
+// stringList is a flag.Value accumulating the values of a repeated
+// command line option.
+type stringList []string
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+// parseOptions parses a command line option value of comma separated
+// items, returning the plain items and a configuration map of the
+// items of the form key=value. Option values are parsed as YAML
+// scalars.
+func parseOptions(s string) (items []string, opts map[string]interface{}, err error) {
+	opts = make(map[string]interface{})
+	for _, item := range strings.Split(s, ",") {
+		i := strings.Index(item, "=")
+		if i < 0 {
+			items = append(items, item)
+			continue
+		}
+		var v interface{}
+		if err = yaml.Unmarshal([]byte(item[i+1:]), &v); err != nil {
+			return nil, nil, fmt.Errorf("Invalid option %s: %v", item, err)
+		}
+		opts[item[:i]] = v
+	}
+	return items, opts, nil
+}
+
+// setOptions validates opts as an element of the configuration list key
+// and stores it in v.
+func setOptions(key string, opts map[string]interface{}, v interface{}) error {
+	b, err := yaml.Marshal(map[string]interface{}{
+		key: []interface{}{opts},
+	})
+	if err != nil {
+		return err
+	}
+	if err := validate(b, false); err != nil {
+		return err
+	}
+	b, err = yaml.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(b, v)
+}
+
+// loadConfig loads the configuration file filename into conf, followed
+// by the files matching its include patterns in lexical order. Lists in
+// included files are appended to the configured lists, and other
+// settings replace the configured values.
 func loadConfig(conf *Config, filename string) error {
 	b, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -44,7 +171,100 @@ func loadConfig(conf *Config, filename string) error {
 	if err := Validate(b); err != nil {
 		return err
 	}
-	return yaml.Unmarshal(b, conf)
+	var keys map[string]interface{}
+	if err := yaml.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	for key := range keys {
+		if key != "include" {
+			conf.setSource(key, "file "+filename)
+		}
+	}
+	if err := yaml.Unmarshal(b, conf); err != nil {
+		return err
+	}
+
+	var patterns []string
+	switch v := keys["include"].(type) {
+	case string:
+		patterns = append(patterns, v)
+	case []interface{}:
+		for _, p := range v {
+			patterns = append(patterns, p.(string))
+		}
+	}
+	var files []string
+	for _, p := range patterns {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(filename), p)
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return fmt.Errorf("%s: invalid include pattern %s: %v", filename, p, err)
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		if err := mergeConfig(conf, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeConfig merges the included configuration file filename into conf.
+func mergeConfig(conf *Config, filename string) error {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := Validate(b); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	var keys map[string]interface{}
+	if err := yaml.Unmarshal(b, &keys); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	if _, ok := keys["include"]; ok {
+		return fmt.Errorf("%s: include is not allowed in an included file", filename)
+	}
+	frag := new(Config)
+	if err := yaml.Unmarshal(b, frag); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	cv := reflect.ValueOf(conf).Elem()
+	fv := reflect.ValueOf(frag).Elem()
+	for i := 0; i < cv.NumField(); i++ {
+		key := configKey(cv.Type().Field(i))
+		if _, ok := keys[key]; !ok || key == "" {
+			continue
+		}
+		source := "file " + filename
+		cf, ff := cv.Field(i), fv.Field(i)
+		switch cf.Kind() {
+		case reflect.Slice:
+			cf.Set(reflect.AppendSlice(cf, ff))
+		case reflect.Map:
+			if cf.IsNil() {
+				cf.Set(reflect.MakeMap(cf.Type()))
+			}
+			for _, k := range ff.MapKeys() {
+				cf.SetMapIndex(k, ff.MapIndex(k))
+			}
+		default:
+			cf.Set(ff)
+		}
+		if k := cf.Kind(); k == reflect.Slice || k == reflect.Map {
+			// Merged lists name every contributing file.
+			if old := conf.Source(key); strings.HasPrefix(old, "file ") {
+				source = old + ", " + filename
+			}
+		}
+		conf.setSource(key, source)
+	}
+	return nil
 }
 
 func parseConfig(args []string) (conf *Config, err error) {
@@ -52,11 +272,28 @@ func parseConfig(args []string) (conf *Config, err error) {
 	var statsInterval, heartBeat, retry, flush config.Duration
 	var apiKey config.String
 	var inputSocket string
+	var inputMode socketMode
+	var inputGroup string
+	var inputRemove bool
+	var userName, groupName string
 	var channel uint
 	var mtu int
 	var trace bool
+	var traceSample, traceRate int
+	var traceQnames nameFilter
+	var traceFile string
 	var qfilter nameFilter
-	var udpOutputAddr config.UDPAddr
+	var udpOutputs udpOutputList
+	var shardedOutputs shardedOutputList
+	var pipelines pipelineList
+	var tlsCAFile, tlsCertFile, tlsKeyFile string
+	var tlsPins stringList
+	var proxy string
+	var metricsListen string
+	var inputIdle config.Duration
+	var shutdownTimeout config.Duration
+	var logLevelName, logFormat string
+	var checkConfig, printConfig, printSchema bool
 
 	fs := flag.NewFlagSet("dnstap-sensor", flag.ExitOnError)
 
@@ -64,6 +301,15 @@ func parseConfig(args []string) (conf *Config, err error) {
 		"Location of client config file")
 	fs.StringVar(&inputSocket, "input", "",
 		"Path to dnstap input socket")
+	fs.Var(&inputMode, "input_socket_mode", "octal permissions of the input socket")
+	fs.StringVar(&inputGroup, "input_socket_group", "",
+		"group name or id owning the input socket")
+	fs.BoolVar(&inputRemove, "input_socket_remove", true,
+		"remove a stale input socket at startup and the input socket at exit")
+	fs.StringVar(&userName, "user", "",
+		"user name or id to run as after creating the input socket")
+	fs.StringVar(&groupName, "group", "",
+		"group name or id to run as after creating the input socket")
 	fs.Var(&statsInterval, "stats_interval", "statistics logging interval (default 15m)")
 	fs.Var(&heartBeat, "heartbeat", "heartbeat interval (default 30s)")
 	fs.Var(&retry, "retry", "connection retry interval (default 30s)")
@@ -73,15 +319,54 @@ func parseConfig(args []string) (conf *Config, err error) {
 	fs.UintVar(&channel, "channel", 0, "channel to upload dnstap data")
 	fs.IntVar(&mtu, "mtu", nmsg.EtherContainerSize, "UDP output buffer size")
 	fs.BoolVar(&trace, "trace", false, "log activity (verbose, recommended for debugging only)")
-	fs.Var(&udpOutputAddr, "udp_output", "send NMSG UDP output to addr udp:<addr>:host")
+	fs.IntVar(&traceSample, "trace_sample", 0, "trace one in every n messages")
+	fs.IntVar(&traceRate, "trace_rate", 0, "maximum trace messages per second (default unlimited)")
+	fs.Var(&traceQnames, "trace_qname", "trace only responses to queries under domain")
+	fs.StringVar(&traceFile, "trace_file", "", "write trace messages to file instead of standard error")
+	fs.Var(&udpOutputs, "udp_output",
+		"send NMSG UDP output to addr udp:<addr>:host[,<option>=<value>...] (may be repeated)")
+	fs.Var(&shardedOutputs, "sharded_output",
+		"shard NMSG UDP output among udp:<addr>:host[,udp:<addr>:host...][,<option>=<value>...] (may be repeated)")
+	fs.Var(&pipelines, "pipeline",
+		"send selected dnstap to the outputs of a pipeline given in YAML flow style, e.g. {name: <name>, upload: true} (may be repeated)")
+	fs.StringVar(&tlsCAFile, "tls_ca_file", "",
+		"PEM file of CA certificates for verifying wss:// servers")
+	fs.StringVar(&tlsCertFile, "tls_cert_file", "",
+		"PEM client certificate for wss:// servers")
+	fs.StringVar(&tlsKeyFile, "tls_key_file", "",
+		"PEM private key for -tls_cert_file")
+	fs.Var(&tlsPins, "tls_pin_sha256", "base64 SHA-256 hash of an accepted wss:// server public key")
+	fs.StringVar(&proxy, "proxy", "", "HTTP proxy URL for server connections (default $HTTPS_PROXY)")
+	fs.StringVar(&metricsListen, "metrics_listen", "",
+		"serve Prometheus metrics over HTTP at addr:port/metrics")
+	fs.Var(&inputIdle, "input_idle", "warn and report not ready after no dnstap input for duration (default 5m)")
+	fs.Var(&shutdownTimeout, "shutdown_timeout", "maximum time to wait for uploads at shutdown (default 10s)")
+	fs.StringVar(&logLevelName, "log_level", "",
+		"minimum level of logged messages: debug, info, warn or error (default info)")
+	fs.StringVar(&logFormat, "log_format", "",
+		"log format: text or json (default text)")
+	fs.BoolVar(&checkConfig, "check-config", false,
+		"validate the configuration and exit")
+	fs.BoolVar(&printConfig, "print-config", false,
+		"print the effective configuration and exit")
+	fs.BoolVar(&printSchema, "print-schema", false,
+		"print the configuration file JSON schema and exit")
 	fs.Parse(args)
 
 	conf = new(Config)
+	conf.CheckConfig = checkConfig
+	conf.PrintConfig = printConfig
+	conf.PrintSchema = printSchema
 	conf.StatsInterval.Set("15m")
 	conf.Heartbeat.Set("30s")
 	conf.Retry.Set("30s")
 	conf.Flush.Set("500ms")
+	conf.InputIdle.Set("5m")
+	conf.ShutdownTimeout.Set("10s")
 	conf.FilterQnames = qfilter
+	conf.TraceQnames = traceQnames
+	conf.LogLevel = levelInfo
+	conf.LogFormat = logFormatText
 	conf.MTU = mtu
 
 	if configFilename != "" {
@@ -90,6 +375,9 @@ func parseConfig(args []string) (conf *Config, err error) {
 			return
 		}
 	}
+	if err = loadEnv(conf, os.Environ()); err != nil {
+		return
+	}
 
 	if statsInterval.Duration != 0 {
 		conf.StatsInterval = statsInterval
@@ -109,14 +397,104 @@ func parseConfig(args []string) (conf *Config, err error) {
 	if inputSocket != "" {
 		conf.DnstapInput = dnstapInput(inputSocket)
 	}
+	if inputMode != 0 {
+		conf.InputMode = inputMode
+	}
+	if inputGroup != "" {
+		conf.InputGroup = inputGroup
+	}
+	if userName != "" {
+		conf.User = userName
+	}
+	if groupName != "" {
+		conf.Group = groupName
+	}
+	fs.Visit(func(f *flag.Flag) {
+		key := f.Name
+		if k, ok := flagKeys[key]; ok {
+			key = k
+		}
+		if _, ok := configKeys[key]; ok {
+			conf.setSource(key, "flag -"+f.Name)
+		}
+		switch f.Name {
+		case "input_socket_remove":
+			conf.InputRemove = &inputRemove
+		case "mtu":
+			conf.MTU = mtu
+		case "trace":
+			conf.Trace = trace
+		}
+	})
 	if channel != 0 {
 		conf.Channel = uint32(channel)
 	}
-	if udpOutputAddr.UDPAddr != nil {
-		conf.UDPOutput = udpOutputAddr
+	if len(udpOutputs) > 0 {
+		conf.UDPOutput = config.UDPAddr{}
+		conf.UDPOutputs = udpOutputs
+	}
+	if len(shardedOutputs) > 0 {
+		conf.ShardedOutputs = shardedOutputs
+	}
+	if len(pipelines) > 0 {
+		conf.Pipelines = pipelines
+	}
+	if conf.UDPOutput.UDPAddr != nil {
+		conf.UDPOutputs = append(udpOutputList{{Address: conf.UDPOutput}},
+			conf.UDPOutputs...)
+		conf.UDPOutput = config.UDPAddr{}
+	}
+	conf.setOutputDefaults(conf.UDPOutputs, conf.ShardedOutputs)
+	for _, pc := range conf.Pipelines {
+		conf.setOutputDefaults(pc.UDPOutputs, pc.ShardedOutputs)
 	}
 
-	conf.Trace = trace
+	if tlsCAFile != "" {
+		conf.TLSCAFile = tlsCAFile
+	}
+	if tlsCertFile != "" {
+		conf.TLSCertFile = tlsCertFile
+	}
+	if tlsKeyFile != "" {
+		conf.TLSKeyFile = tlsKeyFile
+	}
+	if len(tlsPins) > 0 {
+		conf.TLSPins = tlsPins
+	}
+	if logLevelName != "" {
+		if perr := conf.LogLevel.Set(logLevelName); perr != nil {
+			err = perr
+			return
+		}
+	}
+	if logFormat != "" {
+		conf.LogFormat = logFormat
+	}
+	if metricsListen != "" {
+		conf.MetricsListen = metricsListen
+	}
+	if inputIdle.Duration != 0 {
+		conf.InputIdle = inputIdle
+	}
+	if shutdownTimeout.Duration != 0 {
+		conf.ShutdownTimeout = shutdownTimeout
+	}
+	if proxy != "" {
+		if perr := conf.Proxy.Set(proxy); perr != nil {
+			err = fmt.Errorf("Invalid proxy URI %s: %v", proxy, perr)
+			return
+		}
+	}
+
+	if traceSample != 0 {
+		conf.TraceSample = traceSample
+	}
+	if traceRate != 0 {
+		conf.TraceRate = traceRate
+	}
+	if traceFile != "" {
+		conf.TraceFile = traceFile
+	}
 
 	if fs.NArg() > 0 {
 		servers := make([]config.URL, 0, flag.NArg())
@@ -129,18 +507,42 @@ func parseConfig(args []string) (conf *Config, err error) {
 			servers = append(servers, u)
 		}
 		conf.Servers = servers
+		conf.setSource("servers", "command line")
+	}
+	for _, s := range conf.Servers {
+		if s.URL != nil && !strings.HasPrefix(s.Path, "/session/") {
+			s.Path = "/session/dnstap-sensor-upload"
+		}
 	}
 
+	err = conf.validate()
+	return
+}
+
+// validate checks the settings of a parsed configuration.
+func (conf *Config) validate() error {
+	var err error
 	if len(conf.Servers) > 0 && conf.Channel == 0 {
 		err = errors.New("no channel specified")
 	}
-	if len(conf.Servers) == 0 && conf.UDPOutput.UDPAddr == nil {
+	if len(conf.Pipelines) == 0 && len(conf.Servers) == 0 &&
+		len(conf.UDPOutputs) == 0 && len(conf.ShardedOutputs) == 0 {
 		err = errors.New("no servers or output specified")
 	}
-	if conf.UDPOutput.UDPAddr != nil && conf.UDPOutput.UDPAddr.Port == 0 {
-		err = errors.New("no UDP port specified")
+	for i := range conf.UDPOutputs {
+		if oerr := conf.UDPOutputs[i].validate(); oerr != nil {
+			err = oerr
+		}
+	}
+	for i := range conf.ShardedOutputs {
+		if serr := conf.ShardedOutputs[i].validate(); serr != nil {
+			err = serr
+		}
+	}
+	if perr := conf.validatePipelines(); perr != nil {
+		err = perr
 	}
-	if conf.DnstapInput == "" {
+	if len(conf.inputs()) == 0 && os.Getenv("LISTEN_FDS") == "" {
 		err = errors.New("no input specified")
 	}
 	if len(conf.Servers) > 0 && conf.APIKey.String() == "" {
@@ -153,15 +555,142 @@ func parseConfig(args []string) (conf *Config, err error) {
 			nmsg.MaxContainerSize)
 	}
 
+	if conf.TLSCertFile != "" && conf.TLSKeyFile == "" {
+		err = errors.New("no TLS key specified for client certificate")
+	}
+	if conf.TLSKeyFile != "" && conf.TLSCertFile == "" {
+		err = errors.New("no TLS client certificate specified for key")
+	}
+	for _, pin := range conf.TLSPins {
+		if _, perr := parsePin(pin); perr != nil {
+			err = perr
+		}
+	}
+
+	switch conf.LogFormat {
+	case logFormatText, logFormatJSON:
+	default:
+		err = fmt.Errorf("Invalid log format %s: must be %s or %s",
+			conf.LogFormat, logFormatText, logFormatJSON)
+	}
+	if conf.TraceSample < 0 {
+		err = fmt.Errorf("Invalid trace sample %d: must not be negative",
+			conf.TraceSample)
+	}
+	if conf.TraceRate < 0 {
+		err = fmt.Errorf("Invalid trace rate %d: must not be negative",
+			conf.TraceRate)
+	}
+	if conf.Proxy.URL != nil && conf.Proxy.Scheme != "http" {
+		err = fmt.Errorf("Invalid proxy URI scheme %s in %s",
+			conf.Proxy.Scheme, conf.Proxy.Redacted())
+	}
+
 	for _, u := range conf.Servers {
 		switch u.Scheme {
 		case "ws", "wss":
 		default:
-			err = fmt.Errorf("Invalid URI scheme %s in %s",
-				u.Scheme, u)
-			return
+			return fmt.Errorf("Invalid URI scheme %s in %s",
+				u.Scheme, u.Redacted())
 		}
 	}
 
-	return
+	return err
+}
+
+// setOutputDefaults replaces zero settings of the outputs with the global
+// settings.
+func (conf *Config) setOutputDefaults(udpOutputs udpOutputList, sharded shardedOutputList) {
+	for i := range udpOutputs {
+		oc := &udpOutputs[i]
+		if oc.MTU == 0 {
+			oc.MTU = conf.MTU
+		}
+		if oc.Flush.Duration == 0 {
+			oc.Flush = conf.Flush
+		}
+	}
+	for i := range sharded {
+		sc := &sharded[i]
+		if sc.Key == "" {
+			sc.Key = shardKeyQname
+		}
+		if sc.MTU == 0 {
+			sc.MTU = conf.MTU
+		}
+		if sc.Flush.Duration == 0 {
+			sc.Flush = conf.Flush
+		}
+	}
+}
+
+// printConfig writes conf to w in the configuration file format, with
+// secrets redacted and each setting annotated with its source. Unset
+// settings are omitted.
+func printConfig(w io.Writer, conf *Config) error {
+	v := reflect.ValueOf(conf).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := configKey(v.Type().Field(i))
+		if key == "" || key == "udp_output" {
+			continue
+		}
+		fv := v.Field(i)
+		unset := fv.IsZero()
+		if k := fv.Kind(); k == reflect.Slice || k == reflect.Map {
+			unset = fv.Len() == 0
+		}
+		if unset && key != "input_socket_remove" {
+			continue
+		}
+		value := fv.Interface()
+		switch key {
+		case "api_key":
+			if conf.APIKey.String() != "" {
+				value = "(redacted)"
+			}
+		case "servers":
+			servers := make([]string, len(conf.Servers))
+			for i, u := range conf.Servers {
+				servers[i] = u.Redacted()
+			}
+			value = servers
+		case "proxy":
+			if conf.Proxy.URL != nil {
+				value = conf.Proxy.Redacted()
+			}
+		case "input_socket_remove":
+			if conf.InputRemove == nil {
+				value = true
+			}
+		}
+		b, err := yaml.Marshal(yaml.MapSlice{{Key: key, Value: value}})
+		if err != nil {
+			return err
+		}
+		lines := strings.SplitN(string(b), "\n", 2)
+		if _, err := fmt.Fprintf(w, "%s  # %s\n%s",
+			lines[0], conf.Source(key), lines[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConfig reports the result of parsing conf for -check-config and
+// -print-config, and returns the exit status.
+func checkConfig(conf *Config, err error) int {
+	if err == nil {
+		_, err = loadTLSConfig(conf)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return 1
+	}
+	if conf.PrintConfig {
+		if err := printConfig(os.Stdout, conf); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not print configuration: %v\n", err)
+			return 1
+		}
+	}
+	return 0
 }
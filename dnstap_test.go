@@ -10,6 +10,7 @@ package main
 
 import (
 	"bytes"
+	"sync"
 	"testing"
 	"time"
 
@@ -21,7 +22,16 @@ import (
 	"github.com/farsightsec/sielink"
 )
 
-type sliceClient []*dnstap.Dnstap
+type sliceClient struct {
+	sync.Mutex
+	msgs []*dnstap.Dnstap
+}
+
+func (tc *sliceClient) Len() int {
+	tc.Lock()
+	defer tc.Unlock()
+	return len(tc.msgs)
+}
 
 func (tc *sliceClient) Close() error                     { return nil }
 func (tc *sliceClient) DialAndHandle(uri string) error   { return nil }
@@ -30,7 +40,8 @@ func (tc *sliceClient) Subscribe(...uint32)              {}
 
 func (tc *sliceClient) Send(p *sielink.Payload) error {
 	inp := nmsg.NewInput(bytes.NewReader(p.GetData()), len(p.GetData()))
-	msgs := *tc
+	tc.Lock()
+	defer tc.Unlock()
 	for {
 		p, err := inp.Recv()
 		if err != nil {
@@ -41,10 +52,9 @@ func (tc *sliceClient) Send(p *sielink.Payload) error {
 			break
 		}
 		if dt, ok := m.(*nmsg_base.Dnstap); ok {
-			msgs = append(msgs, &dt.Dnstap)
+			tc.msgs = append(tc.msgs, &dt.Dnstap)
 		}
 	}
-	*tc = msgs
 	return nil
 }
 
@@ -60,31 +70,71 @@ func TestDnstapMessageType(t *testing.T) {
 			}},
 	}
 
-	tclient := make(sliceClient, 0)
+	tclient := new(sliceClient)
 
 	ctx := &Context{
-		Client: &tclient,
+		Client: tclient,
 		Config: &Config{Channel: 203},
 	}
 	ctx.Config.Flush.Set("10ms")
-	dtin := dnstapInput("in")
-	dtch := make(chan []byte)
+	pipelines, _ := ctx.newPipelines(ctx.Config)
+	ctx.setPipelines(ctx.Config, pipelines)
+	dtch := make(chan frame)
 
-	go dtin.publish(ctx, dtch)
+	go publish(ctx, dtch)
 	for i := range testCases {
 		tc := &testCases[i]
 		b, err := proto.Marshal(tc)
 		if err != nil {
 			t.Error(tc, err)
 		}
-		dtch <- b
+		dtch <- frame{input: "in", data: b}
+	}
+
+	dtch <- frame{input: "in", data: make([]byte, 100)}
+
+	<-time.After(50 * time.Millisecond)
+	if tclient.Len() != 1 {
+		t.Error("expected 1 message, got ", tclient.Len())
 	}
+}
 
-	dtch <- make([]byte, 100)
+func TestUploadFlushReload(t *testing.T) {
+	b, err := proto.Marshal(&dnstap.Dnstap{
+		Type: dnstap.Dnstap_MESSAGE.Enum(),
+		Message: &dnstap.Message{
+			Type: dnstap.Message_RESOLVER_RESPONSE.Enum(),
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
 
+	tclient := new(sliceClient)
+	ctx := &Context{
+		Client: tclient,
+		Config: &Config{Channel: 203},
+	}
+	ctx.Config.Flush.Set("1h")
+	pipelines, _ := ctx.newPipelines(ctx.Config)
+	ctx.setPipelines(ctx.Config, pipelines)
+	dtch := make(chan frame)
+	go publish(ctx, dtch)
+	defer close(dtch)
+
+	dtch <- frame{input: "in", data: b}
+	conf := *ctx.Config
+	conf.Flush.Set("10ms")
+	ctx.mu.Lock()
+	ctx.Config = &conf
+	ctx.setPipelines(&conf, ctx.pipelines())
+	ctx.mu.Unlock()
+
+	// The next message flushes the buffer of the old interval, and is
+	// itself flushed after the new one.
+	dtch <- frame{input: "in", data: b}
 	<-time.After(50 * time.Millisecond)
-	if len(tclient) != 1 {
-		t.Error("expected 1 message, got ", len(tclient))
+	if tclient.Len() != 2 {
+		t.Errorf("%d messages uploaded after flush change, expected 2", tclient.Len())
 	}
 }
 
@@ -122,21 +172,22 @@ func TestWriterDiscard(t *testing.T) {
 		Config: &Config{Channel: 203},
 	}
 	ctx.Config.Flush.Set("10ms")
-	dtin := dnstapInput("in")
-	dtch := make(chan []byte)
+	pipelines, _ := ctx.newPipelines(ctx.Config)
+	ctx.setPipelines(ctx.Config, pipelines)
+	dtch := make(chan frame)
 
-	go dtin.publish(ctx, dtch)
+	go publish(ctx, dtch)
 
 	// First message goes through buffer, is picked up by the
 	// sending goroutine
-	dtch <- testMessage
+	dtch <- frame{input: "in", data: testMessage}
 	<-time.After(50 * time.Millisecond)
 	// Second message stalls in the buffer
-	dtch <- testMessage
+	dtch <- frame{input: "in", data: testMessage}
 	<-time.After(50 * time.Millisecond)
 	// Third message should kick the above message out out,
 	// and record a loss of one payload.
-	dtch <- testMessage
+	dtch <- frame{input: "in", data: testMessage}
 	<-time.After(50 * time.Millisecond)
 
 	// Fetch first message, should have loss counter zero
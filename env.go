@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// envPrefix is prepended to the upper case configuration key to form
+// the name of the environment variable setting it.
+const envPrefix = "DNSTAP_SENSOR_"
+
+// envAliases maps the environment variable names historically used by
+// the debian defaults file to their configuration keys.
+var envAliases = map[string]string{
+	envPrefix + "APIKEY": "api_key",
+	envPrefix + "INPUT":  "dnstap_input",
+}
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// configKey returns the configuration file key of a Config field, or
+// the empty string if the field is not set from the configuration file.
+func configKey(f reflect.StructField) string {
+	key := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+// configKeys maps the configuration file keys to the types of the Config
+// fields they set.
+var configKeys = func() map[string]reflect.Type {
+	keys := make(map[string]reflect.Type)
+	ct := reflect.TypeOf(Config{})
+	for i := 0; i < ct.NumField(); i++ {
+		if key := configKey(ct.Field(i)); key != "" {
+			keys[key] = ct.Field(i).Type
+		}
+	}
+	return keys
+}()
+
+// envValue converts the value of an environment variable setting a
+// configuration field of type t to its configuration file equivalent.
+// Lists are given as a YAML flow sequence or separated by whitespace or
+// commas, numbers and booleans as YAML scalars, and all other values,
+// including those of types parsing their own YAML, are taken as strings.
+func envValue(t reflect.Type, s string) (interface{}, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var v interface{}
+	if k := t.Kind(); k != reflect.Slice && k != reflect.Map &&
+		reflect.PtrTo(t).Implements(unmarshalerType) {
+		return s, nil
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map:
+		if strings.HasPrefix(strings.TrimSpace(s), "[") {
+			err := yaml.Unmarshal([]byte(s), &v)
+			return v, err
+		}
+		var l []interface{}
+		for _, f := range strings.FieldsFunc(s, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\n'
+		}) {
+			l = append(l, f)
+		}
+		return l, nil
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		err := yaml.Unmarshal([]byte(s), &v)
+		return v, err
+	}
+	return s, nil
+}
+
+// envName returns the environment variable name for a configuration key.
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(key)
+}
+
+// envConfig returns a configuration document built from the
+// DNSTAP_SENSOR_<KEY> variables in environ, a list of "name=value"
+// strings, and the names of the variables setting each key. Empty and
+// unrecognized variables are ignored. Each value is validated against the
+// configuration schema, and errors name the offending variable.
+func envConfig(environ []string) ([]byte, map[string]string, error) {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		i := strings.Index(kv, "=")
+		if i < 0 || !strings.HasPrefix(kv, envPrefix) || kv[i+1:] == "" {
+			continue
+		}
+		env[kv[:i]] = kv[i+1:]
+	}
+	var names []string
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	doc := make(map[string]interface{})
+	set := make(map[string]string)
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimPrefix(name, envPrefix))
+		if alias, ok := envAliases[name]; ok {
+			if _, ok := env[envName(alias)]; ok {
+				// The variable named for the key takes precedence.
+				continue
+			}
+			key = alias
+		}
+		t, ok := configKeys[key]
+		if !ok {
+			continue
+		}
+		v, err := envValue(t, env[name])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", name, err)
+		}
+		b, err := yaml.Marshal(map[string]interface{}{key: v})
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if err := validate(b, false); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", name, err)
+		}
+		doc[key] = v
+		set[key] = name
+	}
+	if len(doc) == 0 {
+		return nil, nil, nil
+	}
+	b, err := yaml.Marshal(doc)
+	return b, set, err
+}
+
+// loadEnv sets the fields of conf from the DNSTAP_SENSOR_<KEY> variables
+// in environ.
+func loadEnv(conf *Config, environ []string) error {
+	b, set, err := envConfig(environ)
+	if err != nil || b == nil {
+		return err
+	}
+	for key, name := range set {
+		conf.setSource(key, "env "+name)
+	}
+	// Clear the settings the environment overrides, as unmarshaling
+	// would add to the lists and maps loaded from the file.
+	cv := reflect.ValueOf(conf).Elem()
+	for i := 0; i < cv.NumField(); i++ {
+		f := cv.Type().Field(i)
+		if _, ok := set[configKey(f)]; ok {
+			cv.Field(i).Set(reflect.Zero(f.Type))
+		}
+	}
+	return yaml.Unmarshal(b, conf)
+}
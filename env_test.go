@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvConfig(t *testing.T) {
+	t.Setenv("DNSTAP_SENSOR_CHANNEL", "203")
+	t.Setenv("DNSTAP_SENSOR_HEARTBEAT", "1m")
+	t.Setenv("DNSTAP_SENSOR_RETRY", "1m")
+	t.Setenv("DNSTAP_SENSOR_FILTER_QNAMES", "example.com, example.net")
+	t.Setenv("DNSTAP_SENSOR_INPUT_SOCKET_MODE", "0660")
+	t.Setenv("DNSTAP_SENSOR_INPUT_SOCKET_REMOVE", "false")
+	t.Setenv("DNSTAP_SENSOR_APIKEY", "alias")
+	t.Setenv("DNSTAP_SENSOR_API_KEY", "")
+	t.Setenv("DNSTAP_SENSOR_ARGS", "-trace")
+
+	conf, err := parseConfig([]string{"-config", "t/config/complete.conf",
+		"-retry", "5s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Channel != 203 {
+		t.Errorf("channel %d, expected environment to override file", conf.Channel)
+	}
+	if conf.Heartbeat.Duration != time.Minute {
+		t.Errorf("heartbeat %s, expected 1m from environment", conf.Heartbeat)
+	}
+	if conf.Retry.Duration != 5*time.Second {
+		t.Errorf("retry %s, expected flag to override environment", conf.Retry)
+	}
+	if names := conf.FilterQnames.Names(); !reflect.DeepEqual(names,
+		[]string{"example.com.", "example.net."}) {
+		t.Errorf("filter_qnames %v", names)
+	}
+	if conf.InputMode != 0660 {
+		t.Errorf("input socket mode %s", conf.InputMode.String())
+	}
+	if conf.InputRemove == nil || *conf.InputRemove {
+		t.Error("input socket remove not set from environment")
+	}
+	if conf.APIKey.String() != "alias" {
+		t.Errorf("api key %q, expected value of alias", conf.APIKey.String())
+	}
+
+	t.Setenv("DNSTAP_SENSOR_API_KEY", "key")
+	if conf, err = parseConfig([]string{"-config", "t/config/complete.conf"}); err != nil {
+		t.Fatal(err)
+	}
+	if conf.APIKey.String() != "key" {
+		t.Errorf("api key %q, expected alias to be overridden", conf.APIKey.String())
+	}
+}
+
+func TestEnvConfigInvalid(t *testing.T) {
+	for _, tc := range []struct{ name, value string }{
+		{"DNSTAP_SENSOR_CHANNEL", "many"},
+		{"DNSTAP_SENSOR_LOG_FORMAT", "xml"},
+		{"DNSTAP_SENSOR_UDP_OUTPUTS", "[{mtu: 1500}]"},
+		{"DNSTAP_SENSOR_SERVERS", "[unterminated"},
+	} {
+		_, _, err := envConfig([]string{tc.name + "=" + tc.value})
+		if err == nil {
+			t.Errorf("accepted %s=%s", tc.name, tc.value)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tc.name+": ") {
+			t.Errorf("error %q does not name %s", err, tc.name)
+		}
+	}
+}
+
+func TestEnvConfigReplacesLists(t *testing.T) {
+	t.Setenv("DNSTAP_SENSOR_SERVERS", "ws://env.example/session/dnstap-sensor-upload")
+	t.Setenv("DNSTAP_SENSOR_FILTER_QNAMES", "example.net")
+
+	conf, err := parseConfig([]string{"-config", "t/config/env-lists.conf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Servers) != 1 || conf.Servers[0].Host != "env.example" {
+		t.Errorf("servers %v, expected environment to replace file", conf.Servers)
+	}
+	if names := conf.FilterQnames.Names(); !reflect.DeepEqual(names, []string{"example.net."}) {
+		t.Errorf("filter_qnames %v, expected environment to replace file", names)
+	}
+	if names := conf.TraceQnames.Names(); !reflect.DeepEqual(names, []string{"example.com."}) {
+		t.Errorf("trace_qnames %v, expected file value", names)
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"errors"
+	"github.com/dnstap/golang-dnstap"
 	"github.com/miekg/dns"
+	"sort"
 	"strings"
 )
 
@@ -66,6 +68,23 @@ func (n *nameFilter) UnmarshalYAML(u func(interface{}) error) error {
 	return nil
 }
 
+// Names returns the filtered names in sorted text form.
+func (n nameFilter) Names() []string {
+	var names []string
+	for k := range n {
+		name, _, err := dns.UnpackDomainName([]byte(k), 0)
+		if err == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (n nameFilter) MarshalYAML() (interface{}, error) {
+	return n.Names(), nil
+}
+
 func (n *nameFilter) Set(s string) error {
 	return n.AddString(s)
 }
@@ -91,14 +110,34 @@ func (n nameFilter) FilterMsgQname(m []byte) (bool, error) {
 		return false, nil
 	}
 
+	name, err := msgQname(m)
+	if name == nil {
+		return false, err
+	}
+
+	return n.Lookup(name), nil
+}
+
+// dnsMessage returns the DNS response carried by the dnstap message m,
+// or its DNS query if there is no response.
+func dnsMessage(m *dnstap.Message) []byte {
+	if msg := m.GetResponseMessage(); msg != nil {
+		return msg
+	}
+	return m.GetQueryMessage()
+}
+
+// msgQname returns the downcased, uncompressed wire format qname of the
+// DNS message m, or nil if the message does not have exactly one question.
+func msgQname(m []byte) ([]byte, error) {
 	// Chop off 12-byte fixed DNS message header
 	if len(m) <= 12 {
-		return false, errShortMessage
+		return nil, errShortMessage
 	}
 
 	// Pass if qdcount != 1
 	if m[4] != 0 || m[5] != 1 {
-		return false, nil
+		return nil, nil
 	}
 
 	m = m[12:]
@@ -112,12 +151,12 @@ func (n nameFilter) FilterMsgQname(m []byte) (bool, error) {
 			break
 		}
 		if llen > 63 {
-			return false, errInvalidQname
+			return nil, errInvalidQname
 		}
 
 		lend := llen + i + 1
 		if lend >= len(m) {
-			return false, errTruncMessage
+			return nil, errTruncMessage
 		}
 		name = append(name, byte(llen))
 
@@ -127,8 +166,8 @@ func (n nameFilter) FilterMsgQname(m []byte) (bool, error) {
 		}
 	}
 	if len(name) == 0 {
-		return false, errTruncMessage
+		return nil, errTruncMessage
 	}
 
-	return n.Lookup(name), nil
+	return name, nil
 }
@@ -0,0 +1,249 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// health records the input state checked by the readiness endpoint. It
+// may be updated and read concurrently.
+type health struct {
+	listening int32 // set while the input sockets are listening
+
+	queued func() int // length of the input queue, set before input starts
+
+	mu     sync.Mutex
+	inputs map[dnstapInput]*inputHealth
+}
+
+// inputHealth records the idle state of one input.
+type inputHealth struct {
+	lastInput atomic.Int64  // time of the last dnstap message, in Unix nanoseconds
+	idle      int32         // set while the input is idle beyond its threshold
+	idleCount atomic.Uint64 // number of times the input has become idle
+}
+
+// input returns the idle state of input i.
+func (h *health) input(i dnstapInput) *inputHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.inputs == nil {
+		h.inputs = make(map[dnstapInput]*inputHealth)
+	}
+	ih := h.inputs[i]
+	if ih == nil {
+		ih = new(inputHealth)
+		h.inputs[i] = ih
+	}
+	return ih
+}
+
+// Inputs returns the inputs whose idle state is recorded, in order.
+func (h *health) Inputs() []dnstapInput {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var inputs []dnstapInput
+	for i := range h.inputs {
+		inputs = append(inputs, i)
+	}
+	sort.Slice(inputs, func(a, b int) bool { return inputs[a] < inputs[b] })
+	return inputs
+}
+
+func (h *health) setListening(listening bool) {
+	var v int32
+	if listening {
+		v = 1
+	}
+	atomic.StoreInt32(&h.listening, v)
+}
+
+func (h *health) Listening() bool {
+	return atomic.LoadInt32(&h.listening) == 1
+}
+
+// received records the arrival of a dnstap message. If the input was
+// idle, received clears the idle flag and returns true with the time
+// since the previous message. A nil inputHealth records nothing.
+func (h *inputHealth) received() (resumed bool, idle time.Duration) {
+	if h == nil {
+		return false, 0
+	}
+	now := time.Now().UnixNano()
+	prev := h.lastInput.Swap(now)
+	if atomic.LoadInt32(&h.idle) == 0 || !atomic.CompareAndSwapInt32(&h.idle, 1, 0) {
+		return false, 0
+	}
+	if prev == 0 {
+		return true, 0
+	}
+	return true, time.Duration(now - prev)
+}
+
+// checkIdle sets the idle flag if no message has arrived within threshold,
+// or since start if none has arrived. It returns true, with the time since
+// the last message or start, only if the input has newly become idle.
+func (h *inputHealth) checkIdle(threshold time.Duration, start time.Time) (bool, time.Duration) {
+	last := h.LastInput()
+	if last.IsZero() {
+		last = start
+	}
+	idle := time.Since(last)
+	if idle < threshold || !atomic.CompareAndSwapInt32(&h.idle, 0, 1) {
+		return false, 0
+	}
+	h.idleCount.Add(1)
+	return true, idle
+}
+
+// Idle returns true if the input is idle beyond its threshold.
+func (h *inputHealth) Idle() bool {
+	return atomic.LoadInt32(&h.idle) == 1
+}
+
+// LastInput returns the arrival time of the last dnstap message, or the
+// zero time if none has arrived.
+func (h *inputHealth) LastInput() time.Time {
+	n := h.lastInput.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// Healthy returns true if the UDP output is not waiting to re-dial after
+// a failure.
+func (u *udpOutput) Healthy() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.out != nil
+}
+
+type healthCheck struct {
+	Name   string `json:"name"`
+	Input  string `json:"input,omitempty"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+type healthStatus struct {
+	Status string        `json:"status"`
+	Uptime string        `json:"uptime"`
+	Checks []healthCheck `json:"checks,omitempty"`
+}
+
+func (ctx *Context) checkInput() healthCheck {
+	c := healthCheck{Name: "input", OK: ctx.health.Listening()}
+	inputs := inputNames(ctx.config().inputs())
+	if c.OK {
+		c.Detail = fmt.Sprintf("listening on %s", inputs)
+	} else {
+		c.Detail = fmt.Sprintf("not listening on %s", inputs)
+	}
+	return c
+}
+
+func (ctx *Context) checkOutput() healthCheck {
+	c := healthCheck{Name: "output"}
+	var up, total int
+	if sc, ok := ctx.Client.(interface{ Connected(string) bool }); ok {
+		for _, s := range ctx.config().Servers {
+			total++
+			if sc.Connected(s.String()) {
+				up++
+			}
+		}
+	}
+	udpOutputs, sharded := ctx.outputs()
+	var outputs []*udpOutput
+	outputs = append(outputs, udpOutputs...)
+	for _, so := range sharded {
+		outputs = append(outputs, so.shards...)
+	}
+	for _, o := range outputs {
+		total++
+		if o.Healthy() {
+			up++
+		}
+	}
+	c.OK = up > 0
+	c.Detail = fmt.Sprintf("%d of %d server connections and UDP outputs up", up, total)
+	return c
+}
+
+// checkIdle returns an idle check for each input.
+func (ctx *Context) checkIdle() []healthCheck {
+	var checks []healthCheck
+	conf := ctx.config()
+	for _, i := range ctx.health.Inputs() {
+		ih := ctx.health.input(i)
+		window := conf.idleThreshold(i)
+		c := healthCheck{Name: "input_idle", Input: string(i), OK: true}
+		last := ih.LastInput()
+		switch {
+		case window == 0 && last.IsZero():
+			c.Detail = "no dnstap received, idle check disabled"
+		case window == 0:
+			c.Detail = fmt.Sprintf("last dnstap received %s ago, idle check disabled",
+				time.Since(last).Truncate(time.Second))
+		case last.IsZero():
+			c.OK = !ih.Idle()
+			c.Detail = fmt.Sprintf("no dnstap received since start, window %s", window)
+		default:
+			idle := time.Since(last)
+			c.OK = !ih.Idle()
+			c.Detail = fmt.Sprintf("last dnstap received %s ago, window %s",
+				idle.Truncate(time.Second), window)
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+func (ctx *Context) writeHealth(w http.ResponseWriter, checks []healthCheck) {
+	st := healthStatus{
+		Status: "ok",
+		Uptime: time.Since(ctx.stats.StartTime).Truncate(time.Second).String(),
+		Checks: checks,
+	}
+	code := http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			st.Status = "fail"
+			code = http.StatusServiceUnavailable
+		}
+	}
+	b, _ := json.Marshal(st)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(b, '\n'))
+}
+
+// serveHealthz reports that the process is alive.
+func (ctx *Context) serveHealthz(w http.ResponseWriter, req *http.Request) {
+	ctx.writeHealth(w, nil)
+}
+
+// serveReadyz reports whether the sensor is listening for input, has a
+// working output, and has received input on each input within the idle
+// window. It responds with status 503 if any check fails.
+func (ctx *Context) serveReadyz(w http.ResponseWriter, req *http.Request) {
+	checks := []healthCheck{
+		ctx.checkInput(),
+		ctx.checkOutput(),
+	}
+	ctx.writeHealth(w, append(checks, ctx.checkIdle()...))
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/farsightsec/go-config"
+	"github.com/farsightsec/sielink/client"
+)
+
+func readyz(t *testing.T, ctx *Context) (int, map[string]bool) {
+	rec := httptest.NewRecorder()
+	ctx.serveReadyz(rec, httptest.NewRequest("GET", "/readyz", nil))
+	var st healthStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body)
+	}
+	checks := make(map[string]bool)
+	for _, c := range st.Checks {
+		name := c.Name
+		if c.Input != "" {
+			name += " " + c.Input
+		}
+		checks[name] = c.OK
+	}
+	return rec.Code, checks
+}
+
+func TestReadyz(t *testing.T) {
+	var server config.URL
+	server.Set("wss://submit.example/session/dnstap-sensor-upload")
+	ctx := &Context{Config: &Config{
+		DnstapInput: "/tmp/dnstap.sock",
+		Servers:     []config.URL{server},
+	}}
+	ctx.Config.InputIdle.Set("1m")
+	ctx.stats.StartTime = time.Now().Add(-2 * time.Minute)
+	sc := newClient(&client.Config{}, nil)
+	ctx.Client = sc
+
+	resolver := ctx.health.input("/tmp/dnstap.sock")
+	forwarder := ctx.health.input("/tmp/forwarder.sock")
+	resolver.checkIdle(ctx.Config.InputIdle.Duration, ctx.stats.StartTime)
+	forwarder.checkIdle(ctx.Config.InputIdle.Duration, ctx.stats.StartTime)
+	code, checks := readyz(t, ctx)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, expected 503", code)
+	}
+	for name, ok := range checks {
+		if ok {
+			t.Errorf("check %s passed before startup", name)
+		}
+	}
+
+	ctx.health.setListening(true)
+	resolver.received()
+	forwarder.received()
+	sc.setConnected(server.String(), true)
+	code, checks = readyz(t, ctx)
+	if code != http.StatusOK {
+		t.Errorf("status %d, expected 200: %v", code, checks)
+	}
+
+	// Each input is checked separately.
+	forwarder.lastInput.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	forwarder.checkIdle(ctx.Config.InputIdle.Duration, ctx.stats.StartTime)
+	code, checks = readyz(t, ctx)
+	if code != http.StatusServiceUnavailable || checks["input_idle /tmp/forwarder.sock"] ||
+		!checks["input_idle /tmp/dnstap.sock"] {
+		t.Errorf("status %d, expected idle forwarder input to fail: %v", code, checks)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	ctx := &Context{Config: &Config{}}
+	rec := httptest.NewRecorder()
+	ctx.serveHealthz(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d, expected 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type %s", ct)
+	}
+}
+
+func TestInputIdle(t *testing.T) {
+	var h inputHealth
+	start := time.Now().Add(-time.Minute)
+
+	if idle, _ := h.checkIdle(2*time.Minute, start); idle {
+		t.Error("idle within threshold of start")
+	}
+	if idle, d := h.checkIdle(30*time.Second, start); !idle || d < time.Minute {
+		t.Errorf("checkIdle = %v, %s; expected idle for 1m", idle, d)
+	}
+	if idle, _ := h.checkIdle(30*time.Second, start); idle {
+		t.Error("idle reported twice")
+	}
+	if !h.Idle() || h.idleCount.Load() != 1 {
+		t.Errorf("idle flag %v count %d", h.Idle(), h.idleCount.Load())
+	}
+
+	if resumed, _ := h.received(); !resumed {
+		t.Error("resume not reported")
+	}
+	if resumed, _ := h.received(); resumed || h.Idle() {
+		t.Error("input still idle after resume")
+	}
+
+	h.lastInput.Store(time.Now().Add(-time.Minute).UnixNano())
+	h.checkIdle(30*time.Second, start)
+	if resumed, d := h.received(); !resumed || d < time.Minute {
+		t.Errorf("received = %v, %s; expected resume after 1m", resumed, d)
+	}
+	if h.idleCount.Load() != 2 {
+		t.Errorf("idle count %d, expected 2", h.idleCount.Load())
+	}
+}
@@ -9,9 +9,18 @@
 package main
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/dnstap/golang-dnstap"
 	"github.com/golang/protobuf/proto"
 
 	"github.com/farsightsec/go-nmsg"
@@ -20,16 +29,245 @@ import (
 
 type dnstapInput string
 
-func (i dnstapInput) run(ctx *Context) {
-	traceMsg(ctx, "Opening dnstap socket input at %s", i)
-	fsinput, err := dnstap.NewFrameStreamSockInputFromPath(string(i))
+// A socketMode holds the permission bits of the input socket, given in
+// octal.
+type socketMode os.FileMode
+
+func (m *socketMode) Set(s string) error {
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 0777 {
+		return fmt.Errorf("Invalid socket mode %s: must be octal permissions", s)
+	}
+	*m = socketMode(n)
+	return nil
+}
+
+func (m *socketMode) String() string {
+	if m == nil || *m == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%04o", uint32(*m))
+}
+
+func (m socketMode) MarshalYAML() (interface{}, error) {
+	return m.String(), nil
+}
+
+// UnmarshalYAML accepts the mode as a string, or as an integer such as
+// an unquoted 0660, which YAML reads as octal.
+func (m *socketMode) UnmarshalYAML(u func(interface{}) error) error {
+	var n int
+	if err := u(&n); err == nil {
+		if n < 0 || n > 0777 {
+			return fmt.Errorf("Invalid socket mode %o", n)
+		}
+		*m = socketMode(n)
+		return nil
+	}
+	var s string
+	if err := u(&s); err != nil {
+		return err
+	}
+	return m.Set(s)
+}
+
+func lookupGroup(name string) (int, error) {
+	g, err := user.LookupGroup(name)
 	if err != nil {
-		log.Fatalf("Could not listen on %s: %s", i, err.Error())
+		if gid, nerr := strconv.Atoi(name); nerr == nil {
+			return gid, nil
+		}
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// listen creates the input socket, first removing any stale socket at its
+// path if so configured, and applies the configured mode and group. The
+// returned listener removes the socket when closed if so configured.
+func (i dnstapInput) listen(conf *Config) (net.Listener, error) {
+	path := string(i)
+	remove := conf.InputRemove == nil || *conf.InputRemove
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if !remove {
+			return nil, fmt.Errorf("socket %s already exists", path)
+		}
+		logInfo("Removing stale input socket", "input", path)
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(remove)
+	if conf.InputGroup != "" {
+		gid, err := lookupGroup(conf.InputGroup)
+		if err == nil {
+			err = os.Chown(path, -1, gid)
+		}
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("setting group %s of %s: %v", conf.InputGroup, path, err)
+		}
+	}
+	if conf.InputMode != 0 {
+		if err := os.Chmod(path, os.FileMode(conf.InputMode)); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// A frame is a dnstap frame read from an input.
+type frame struct {
+	input  dnstapInput
+	health *inputHealth // of the input
+	data   []byte
+}
+
+// inputNames returns the input socket paths for logging.
+func inputNames(inputs []dnstapInput) string {
+	names := make([]string, len(inputs))
+	for n, i := range inputs {
+		names[n] = string(i)
+	}
+	return strings.Join(names, ",")
+}
+
+// readInto accepts connections to the input listener and sends the dnstap
+// data read from them to ch, until the listener is closed. It then closes
+// the input's open connections and returns once their data has been sent
+// to ch.
+func (i dnstapInput) readInto(ctx *Context, l net.Listener, ih *inputHealth, ch chan<- frame) {
+	var wg sync.WaitGroup
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			logWarn("Input accept failed", "input", i, "error", err)
+			time.Sleep(acceptRetry)
+			continue
+		}
+		// Registered before handling, so that closeInput closes it.
+		c := ctx.conns.add(i, conn)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i.handle(ctx, c, ih, ch)
+		}()
+	}
+	ctx.conns.closeInput(i)
+	wg.Wait()
+}
+
+// acceptRetry is the delay before accepting again after a failed accept.
+const acceptRetry = 100 * time.Millisecond
+
+// runInputs listens on the input sockets, or on the only socket passed by
+// the service manager if none are configured, and publishes the dnstap
+// data read from them until the sensor is signaled to shut down.
+func runInputs(ctx *Context, inputs []dnstapInput) {
+	if len(inputs) == 0 {
+		inputs = []dnstapInput{""}
+	}
+	listeners, err := activationInputs(inputs)
+	if err != nil {
+		logFatal("Could not use inherited input socket", "input", inputNames(inputs), "error", err)
+	}
+	closeListeners := func() {
+		for _, l := range listeners {
+			if l != nil {
+				l.Close()
+			}
+		}
+	}
+	for n, i := range inputs {
+		if l := listeners[n]; l != nil {
+			logInfo("Using inherited dnstap socket input", "input", l.Addr())
+			continue
+		}
+		logInfo("Opening dnstap socket input", "input", i)
+		l, err := i.listen(ctx.Config)
+		if err != nil {
+			closeListeners()
+			logFatal("Could not listen on input", "input", i, "error", err)
+		}
+		listeners[n] = l
+	}
+	if err := dropPrivileges(ctx.Config); err != nil {
+		closeListeners()
+		logFatal("Could not drop privileges", "user", ctx.Config.User,
+			"group", ctx.Config.Group, "error", err)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		logInfo("Shutting down", "signal", s)
+		ctx.notifier.Stopping()
+		closeListeners()
+	}()
+
+	names := inputNames(inputs)
+	ctx.health.setListening(true)
+	ch := make(chan frame, 100)
+	ctx.health.queued = func() int { return len(ch) }
+	ctx.metrics.Register("input_queue_length", gaugeMetric,
+		"Dnstap messages waiting to be processed.", nil,
+		func() float64 { return float64(len(ch)) })
+	for _, i := range inputs {
+		ctx.health.input(i).register(&ctx.metrics, i)
+		ctx.conns.register(&ctx.metrics, i)
+	}
+	published := make(chan struct{})
+	go func() {
+		publish(ctx, ch)
+		close(published)
+	}()
+	for _, i := range inputs {
+		if d := ctx.Config.idleThreshold(i); d > 0 {
+			go watchIdle(ctx, i, d)
+		}
+	}
+	ctx.notifyReady()
+	var wg sync.WaitGroup
+	for n, i := range inputs {
+		wg.Add(1)
+		go func(i dnstapInput, l net.Listener) {
+			defer wg.Done()
+			i.readInto(ctx, l, ctx.health.input(i), ch)
+		}(i, listeners[n])
+	}
+	wg.Wait()
+	ctx.health.setListening(false)
+	logInfo("Input finished", "input", names)
+
+	ctx.shutdownDeadline = time.Now().Add(ctx.config().ShutdownTimeout.Duration)
+	close(ch)
+	<-published
+}
+
+// watchIdle logs a warning when no dnstap input has been received on the
+// input for the given threshold. Recovery is logged by publish.
+func watchIdle(ctx *Context, input dnstapInput, threshold time.Duration) {
+	ih := ctx.health.input(input)
+	ticker := time.NewTicker(threshold / 4)
+	defer ticker.Stop()
+	for range ticker.C {
+		if idle, d := ih.checkIdle(threshold, ctx.stats.StartTime); idle {
+			logWarn("No dnstap input received", "input", input,
+				"idle", d.Truncate(time.Second), "threshold", threshold)
+		}
 	}
-	ch := make(chan []byte, 100)
-	go i.publish(ctx, ch)
-	fsinput.ReadInto(ch)
-	log.Printf("input %s finished", i)
 }
 
 func dnstapUnmarshal(b []byte) (*nmsg_base.Dnstap, error) {
@@ -41,70 +279,137 @@ func dnstapUnmarshal(b []byte) (*nmsg_base.Dnstap, error) {
 	return d, nil
 }
 
-func (i dnstapInput) publish(ctx *Context, ch <-chan []byte) {
-	var outputs []nmsg.Output
+// publish sends each dnstap frame from ch through the pipelines which
+// select it, until ch is closed, then flushes the outputs.
+func publish(ctx *Context, ch <-chan frame) {
+	var upload nmsg.Output
+	var pw *payloadWriter
+	flush := ctx.running().flush
 	if ctx.Client != nil {
-		output := nmsg.TimedBufferedOutput(
-			newPayloadWriter(ctx),
-			ctx.Config.Flush.Duration,
-		)
-		output.SetMaxSize(nmsg.MaxContainerSize, 2*nmsg.MaxContainerSize)
-		output.SetCompression(true)
-		outputs = append(outputs, output)
-	}
-	if ctx.Output != nil {
-		outputs = append(outputs, ctx.Output)
-	}
-	for b := range ch {
-		ctx.DnstapIn.Messages++
-		ctx.DnstapIn.Bytes += uint64(len(b))
-		tapm, err := dnstapUnmarshal(b)
-		if err != nil {
-			ctx.DnstapError.Messages++
-			ctx.DnstapError.Bytes += uint64(len(b))
-			traceMsg(ctx, "Error unmarshaling Dnstap message: %s", err)
-			continue
+		pw = newPayloadWriter(ctx)
+		upload = newUploadOutput(pw, flush)
+	}
+	defer func() { ctx.flushOutputs(upload, pw) }()
+	for f := range ch {
+		b := f.data
+		running := ctx.running()
+		if upload != nil && running.flush != flush {
+			// Reloaded with a new flush interval.
+			if err := upload.Close(); err != nil {
+				logWarn("Could not flush upload output", "error", err)
+			}
+			flush = running.flush
+			upload = newUploadOutput(pw, flush)
 		}
-		if tapm.GetMessage().GetType() != dnstap.Message_RESOLVER_RESPONSE {
-			ctx.DnstapFiltered.Messages++
-			ctx.DnstapFiltered.Bytes += uint64(len(b))
-			traceMsg(ctx, "Filtering message of type %s", tapm.GetMessage().GetType())
-			continue
+		ctx.DnstapIn.Add(uint64(len(b)))
+		if resumed, idle := f.health.received(); resumed {
+			logInfo("Dnstap input resumed", "input", f.input, "idle", idle.Truncate(time.Second))
 		}
-		ok, _ := ctx.Config.FilterQnames.FilterMsgQname(tapm.GetMessage().GetResponseMessage())
-		if ok {
-			ctx.QnameFiltered.Messages++
-			ctx.QnameFiltered.Bytes += uint64(len(b))
-			if ctx.Trace {
-				b, ok := dnstap.TextFormat(&tapm.Dnstap)
-				if ok {
-					traceMsg(ctx, "Qname filtered response: %s", string(b))
-				} else {
-					traceMsg(ctx, "Qname filtered response: formatting failed")
-				}
+		tapm, err := dnstapUnmarshal(b)
+		if err != nil {
+			ctx.DnstapError.Add(uint64(len(b)))
+			if ctx.tracer.Select(nil) {
+				traceMsg(ctx, "Error unmarshaling Dnstap message", "error", err)
 			}
 			continue
 		}
-		p, err := nmsg.Payload(tapm)
-		if err != nil {
-			ctx.NmsgError.Messages++
-			ctx.NmsgError.Bytes += uint64(len(b))
-			traceMsg(ctx, "Error converting to NMSG: %s", err)
+		traced := ctx.tracer.Select(tapm)
+		if tapm.Message == nil {
+			// Without a message, the type reads as the default,
+			// AUTH_QUERY, which a pipeline could select.
+			ctx.DnstapFiltered.Add(uint64(len(b)))
+			if traced {
+				traceMsg(ctx, "Filtering frame without message")
+			}
 			continue
 		}
-		if ctx.Trace {
-			b, ok := dnstap.TextFormat(&tapm.Dnstap)
+		typ := tapm.GetMessage().GetType()
+		var selected, filtered int
+		var payload *nmsg.NmsgPayload // of the untransformed message
+		for _, pl := range running.pipelines {
+			if !pl.Selects(f.input, typ) {
+				continue
+			}
+			selected++
+			var kv []interface{}
+			if running.named {
+				kv = []interface{}{"pipeline", pl.Name}
+			}
+			ok, _ := pl.FilterQnames.FilterMsgQname(dnsMessage(tapm.GetMessage()))
 			if ok {
-				traceMsg(ctx, "Submitting response: %s", string(b))
-			} else {
-				traceMsg(ctx, "Submitting response: formatting failed")
+				pl.QnameFiltered.Add(uint64(len(b)))
+				filtered++
+				if traced {
+					ctx.tracer.LogDnstap("Qname filtered response", tapm, kv...)
+				}
+				continue
+			}
+			m, p := tapm, payload
+			if len(pl.Transforms) > 0 {
+				// Transform a copy, leaving tapm for other pipelines.
+				m, _ = dnstapUnmarshal(b)
+				pl.Transform(m)
+				p = nil
+			}
+			if p == nil {
+				p, err = nmsg.Payload(m)
+				if err != nil {
+					ctx.NmsgError.Add(uint64(len(b)))
+					if traced {
+						traceMsg(ctx, "Error converting to NMSG", append(kv, "error", err)...)
+					}
+					continue
+				}
+				if m == tapm {
+					payload = p
+				}
+			}
+			pl.Out.Add(uint64(len(b)))
+			if traced {
+				ctx.tracer.LogDnstap("Submitting response", m, kv...)
 			}
+			pl.send(ctx, upload, m, p, len(b))
 		}
-		for _, o := range outputs {
-			err = o.Send(p)
-			if err != nil {
-				log.Fatal("Output error: ", err)
+		if selected == 0 {
+			ctx.DnstapFiltered.Add(uint64(len(b)))
+			if traced {
+				traceMsg(ctx, "Filtering message", "type", typ)
 			}
+		} else if filtered == selected {
+			ctx.QnameFiltered.Add(uint64(len(b)))
+		}
+	}
+}
+
+// newUploadOutput returns an output buffering NMSG payloads for upload
+// through pw, flushed at least every flush interval.
+func newUploadOutput(pw *payloadWriter, flush time.Duration) nmsg.Output {
+	upload := nmsg.TimedBufferedOutput(pw, flush)
+	upload.SetMaxSize(nmsg.MaxContainerSize, 2*nmsg.MaxContainerSize)
+	upload.SetCompression(true)
+	return upload
+}
+
+// send sends payload p of message m, of n bytes of dnstap input, to the
+// pipeline's outputs, and to upload if the pipeline uploads.
+func (pl *pipeline) send(ctx *Context, upload output, m *nmsg_base.Dnstap, p *nmsg.NmsgPayload, n int) {
+	if pl.Upload && upload != nil {
+		if err := upload.Send(p); err != nil {
+			ctx.NmsgError.Add(uint64(n))
+			traceMsg(ctx, "Output error", "error", err)
+		}
+	}
+	for _, o := range pl.outputs {
+		if err := o.Send(p); err != nil {
+			ctx.NmsgError.Add(uint64(n))
+			traceMsg(ctx, "Output error", "output", o, "error", err)
+		}
+	}
+	for _, so := range pl.sharded {
+		o := so.Select(m)
+		if err := o.Send(p); err != nil {
+			ctx.NmsgError.Add(uint64(n))
+			traceMsg(ctx, "Output error", "output", o, "error", err)
 		}
 	}
 }
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestInputListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dnstap.sock")
+	input := dnstapInput(path)
+
+	// Leave a stale socket behind.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	keep := false
+	conf := &Config{InputRemove: &keep}
+	if _, err := input.listen(conf); err == nil {
+		t.Error("listen succeeded over existing socket with removal disabled")
+	}
+
+	conf = &Config{InputMode: 0640, InputGroup: strconv.Itoa(os.Getgid())}
+	l, err := input.listen(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Errorf("mode %o, expected 0640", fi.Mode().Perm())
+	}
+	if gid := fi.Sys().(*syscall.Stat_t).Gid; int(gid) != os.Getgid() {
+		t.Errorf("group %d, expected %d", gid, os.Getgid())
+	}
+	l.Close()
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket not removed on close: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := input.listen(&Config{}); err == nil {
+		t.Error("listen replaced a regular file")
+	}
+}
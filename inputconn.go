@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dnstap/golang-dnstap"
+)
+
+// A peerCred holds the credentials of the process connected to a Unix
+// socket.
+type peerCred struct {
+	PID, UID, GID int
+}
+
+// An inputConn is a connection to the dnstap input socket. Its embedded
+// statCounter counts the frames received and their size.
+type inputConn struct {
+	id    uint64
+	input dnstapInput
+	conn  net.Conn
+	cred  *peerCred // nil if unavailable
+	start time.Time
+	statCounter
+}
+
+// logFields returns the connection's identity as alternating keys and
+// values for structured logging.
+func (c *inputConn) logFields(kv ...interface{}) []interface{} {
+	fields := []interface{}{"input", c.input, "conn", c.id}
+	if c.cred != nil {
+		fields = append(fields, "pid", c.cred.PID, "uid", c.cred.UID, "gid", c.cred.GID)
+	}
+	return append(fields, kv...)
+}
+
+func (c *inputConn) Log() {
+	logInfo("Input connection stats", c.logFields(
+		"bytes", c.Bytes(),
+		"frames", c.Messages(),
+		"duration", time.Since(c.start).Truncate(time.Second))...)
+}
+
+// inputConns tracks the open connections to the dnstap input sockets.
+type inputConns struct {
+	mu       sync.Mutex
+	conns    map[uint64]*inputConn
+	total    atomic.Uint64 // connections accepted, also the last id assigned
+	accepted map[dnstapInput]uint64
+}
+
+func (cs *inputConns) add(i dnstapInput, conn net.Conn) *inputConn {
+	c := &inputConn{input: i, conn: conn, start: time.Now()}
+	cred, err := peerCredentials(conn)
+	if err != nil {
+		logDebug("Could not get input peer credentials", "input", i, "error", err)
+	}
+	c.cred = cred
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.conns == nil {
+		cs.conns = make(map[uint64]*inputConn)
+		cs.accepted = make(map[dnstapInput]uint64)
+	}
+	c.id = cs.total.Add(1)
+	cs.accepted[i]++
+	cs.conns[c.id] = c
+	return c
+}
+
+func (cs *inputConns) remove(c *inputConn) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.conns, c.id)
+}
+
+// List returns the open connections in the order accepted.
+func (cs *inputConns) List() []*inputConn {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	list := make([]*inputConn, 0, len(cs.conns))
+	for _, c := range cs.conns {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return list
+}
+
+// Total returns the number of connections accepted.
+func (cs *inputConns) Total() uint64 {
+	return cs.total.Load()
+}
+
+// Input returns the number of open connections to input i, and the
+// number accepted.
+func (cs *inputConns) Input(i dnstapInput) (open int, accepted uint64) {
+	for _, c := range cs.List() {
+		if c.input == i {
+			open++
+		}
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return open, cs.accepted[i]
+}
+
+// closeInput closes the open connections to input i.
+func (cs *inputConns) closeInput(i dnstapInput) {
+	for _, c := range cs.List() {
+		if c.input == i {
+			c.conn.Close()
+		}
+	}
+}
+
+func (cs *inputConns) Log() {
+	for _, c := range cs.List() {
+		c.Log()
+	}
+}
+
+// handle reads dnstap frames from an accepted input connection into ch
+// until the connection is closed, then removes it from ctx.conns.
+func (i dnstapInput) handle(ctx *Context, c *inputConn, ih *inputHealth, ch chan<- frame) {
+	defer c.conn.Close()
+	defer ctx.conns.remove(c)
+
+	r, err := dnstap.NewReader(c.conn, &dnstap.ReaderOptions{Bidirectional: true})
+	if err != nil {
+		logWarn("Input connection handshake failed", c.logFields("error", err)...)
+		return
+	}
+	logInfo("Input connection accepted", c.logFields()...)
+
+	buf := make([]byte, dnstap.MaxPayloadSize)
+	for {
+		n, rerr := r.ReadFrame(buf)
+		if rerr != nil {
+			if rerr != io.EOF && !errors.Is(rerr, net.ErrClosed) {
+				err = rerr
+			}
+			break
+		}
+		b := make([]byte, n)
+		copy(b, buf)
+		c.Add(uint64(n))
+		if ctx.tracer.SelectFrame() {
+			traceMsg(ctx, "Received frame", c.logFields("len", n)...)
+		}
+		ch <- frame{i, ih, b}
+	}
+
+	kv := c.logFields(
+		"bytes", c.Bytes(),
+		"frames", c.Messages(),
+		"duration", time.Since(c.start).Truncate(time.Second))
+	if err != nil {
+		kv = append(kv, "error", err)
+	}
+	logInfo("Input connection closed", kv...)
+}
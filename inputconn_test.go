@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnstap/golang-dnstap"
+)
+
+func TestInputConnAccounting(t *testing.T) {
+	logs := new(bytes.Buffer)
+	defaultLogger.SetOutput(logs)
+	defer defaultLogger.SetOutput(os.Stderr)
+
+	dir, err := ioutil.TempDir("", "input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input := dnstapInput(filepath.Join(dir, "dnstap.sock"))
+	l, err := input.listen(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ctx := &Context{Config: &Config{}}
+	ch := make(chan frame, 10)
+	go input.readInto(ctx, l, ctx.health.input(input), ch)
+
+	conn, err := net.Dial("unix", string(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := dnstap.NewWriter(conn, &dnstap.WriterOptions{Bidirectional: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{10, 20, 30} {
+		if _, err := w.WriteFrame(make([]byte, n)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.(interface{ Flush() error }).Flush(); err != nil {
+			t.Fatal(err)
+		}
+		<-ch
+	}
+
+	conns := ctx.conns.List()
+	if len(conns) != 1 {
+		t.Fatalf("%d open connections, expected 1", len(conns))
+	}
+	c := conns[0]
+	if c.Bytes() != 60 || c.Messages() != 3 {
+		t.Errorf("counted %d bytes %d frames, expected 60 / 3", c.Bytes(), c.Messages())
+	}
+	if runtime.GOOS == "linux" {
+		if c.cred == nil || c.cred.PID != os.Getpid() || c.cred.UID != os.Getuid() {
+			t.Errorf("peer credentials %+v, expected pid %d uid %d",
+				c.cred, os.Getpid(), os.Getuid())
+		}
+	}
+
+	w.Close()
+	conn.Close()
+	for i := 0; i < 100 && len(ctx.conns.List()) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(ctx.conns.List()); n != 0 {
+		t.Errorf("%d connections open after close", n)
+	}
+	if ctx.conns.Total() != 1 {
+		t.Errorf("%d connections accepted, expected 1", ctx.conns.Total())
+	}
+
+	defaultLogger.SetOutput(os.Stderr)
+	for _, line := range []string{
+		`msg="Input connection accepted" input=` + string(input) + ` conn=1`,
+		`msg="Input connection closed" input=` + string(input) + ` conn=1`,
+		`bytes=60 frames=3`,
+	} {
+		if !strings.Contains(logs.String(), line) {
+			t.Errorf("log missing %q:\n%s", line, logs)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string {
+	if l < levelDebug || l > levelError {
+		return fmt.Sprintf("level%d", int(l))
+	}
+	return levelNames[l]
+}
+
+// Set satisfies flag.Value.
+func (l *logLevel) Set(s string) error {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			*l = logLevel(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid log level %s: must be one of %s",
+		s, strings.Join(levelNames, ", "))
+}
+
+func (l *logLevel) UnmarshalYAML(u func(interface{}) error) error {
+	var s string
+	if err := u(&s); err != nil {
+		return err
+	}
+	return l.Set(s)
+}
+
+func (l logLevel) MarshalYAML() (interface{}, error) {
+	return l.String(), nil
+}
+
+// Log formats
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// A logger writes leveled log records consisting of a message and a list
+// of alternating keys and values, either as text in the form
+//
+//	level=info msg="Connecting to server" server=wss://...
+//
+// or as one JSON object per line. Like the standard logger, it leaves
+// time stamps to the external logger.
+type logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  logLevel
+	format string
+}
+
+var defaultLogger = &logger{out: os.Stderr, level: levelInfo, format: logFormatText}
+
+// Configure sets the minimum level and format of logged records.
+func (l *logger) Configure(level logLevel, format string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+	l.format = format
+}
+
+// SetOutput sets the destination of logged records.
+func (l *logger) SetOutput(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out = w
+}
+
+// logValue converts v to a value suitable for output: a string, or a
+// number or boolean which JSON encodes directly.
+func logValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string, bool,
+		int, int32, int64, uint, uint32, uint64, float32, float64:
+		return v
+	case time.Duration:
+		return v.String()
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func quoteText(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=\\") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (l *logger) encode(level logLevel, msg string, kv []interface{}) []byte {
+	if len(kv)%2 != 0 {
+		kv = append(kv, "(MISSING)")
+	}
+	buf := new(bytes.Buffer)
+	if l.format == logFormatJSON {
+		// Build the object by hand to preserve key order.
+		buf.WriteString(`{"level":`)
+		b, _ := json.Marshal(level.String())
+		buf.Write(b)
+		buf.WriteString(`,"msg":`)
+		b, _ = json.Marshal(msg)
+		buf.Write(b)
+		for i := 0; i < len(kv); i += 2 {
+			k, _ := json.Marshal(fmt.Sprint(kv[i]))
+			v, err := json.Marshal(logValue(kv[i+1]))
+			if err != nil {
+				v, _ = json.Marshal(fmt.Sprint(kv[i+1]))
+			}
+			buf.WriteByte(',')
+			buf.Write(k)
+			buf.WriteByte(':')
+			buf.Write(v)
+		}
+		buf.WriteString("}\n")
+		return buf.Bytes()
+	}
+
+	fmt.Fprintf(buf, "level=%s msg=%s", level, quoteText(msg))
+	for i := 0; i < len(kv); i += 2 {
+		fmt.Fprintf(buf, " %s=%s", kv[i], quoteText(fmt.Sprint(logValue(kv[i+1]))))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// Log writes a record with the given level, message and key/value pairs
+// if the level is enabled.
+func (l *logger) Log(level logLevel, msg string, kv ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level < l.level {
+		return
+	}
+	l.out.Write(l.encode(level, msg, kv))
+}
+
+func logDebug(msg string, kv ...interface{}) { defaultLogger.Log(levelDebug, msg, kv...) }
+func logInfo(msg string, kv ...interface{})  { defaultLogger.Log(levelInfo, msg, kv...) }
+func logWarn(msg string, kv ...interface{})  { defaultLogger.Log(levelWarn, msg, kv...) }
+func logError(msg string, kv ...interface{}) { defaultLogger.Log(levelError, msg, kv...) }
+
+// logFatal logs an error record and exits.
+func logFatal(msg string, kv ...interface{}) {
+	defaultLogger.Log(levelError, msg, kv...)
+	os.Exit(1)
+}
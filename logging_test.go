@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoggerText(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := &logger{out: buf, level: levelInfo, format: logFormatText}
+
+	l.Log(levelDebug, "suppressed")
+	l.Log(levelWarn, "Server connection closed",
+		"server", "wss://submit.example/",
+		"error", errors.New(`unexpected "EOF"`),
+		"retry", 30*time.Second,
+		"count", 3)
+
+	expect := `level=warn msg="Server connection closed" server=wss://submit.example/ ` +
+		`error="unexpected \"EOF\"" retry=30s count=3` + "\n"
+	if buf.String() != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf, expect)
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := &logger{out: buf, level: levelDebug, format: logFormatJSON}
+
+	l.Log(levelDebug, "stats", "uptime", time.Minute, "dnstap_input_msgs", uint64(42),
+		"error", nil, "odd")
+
+	expect := `{"level":"debug","msg":"stats","uptime":"1m0s",` +
+		`"dnstap_input_msgs":42,"error":null,"odd":"(MISSING)"}` + "\n"
+	if buf.String() != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf, expect)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+		t.Error(err)
+	}
+}
@@ -9,14 +9,12 @@
 package main
 
 import (
-	"io"
 	"log"
-	"net"
 	"os"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/farsightsec/go-nmsg"
 	"github.com/farsightsec/sielink/client"
 )
 
@@ -24,72 +22,24 @@ import (
 type Context struct {
 	*Config
 	client.Client
-	nmsg.Output
 	stats
-}
-
-func traceMsg(ctx *Context, fmt string, args ...interface{}) {
-	if !ctx.Trace {
-		return
-	}
-	log.Printf(fmt, args...)
-}
+	metrics  registry
+	tracer   *tracer
+	health   health
+	conns    inputConns
+	notifier *notifier
+	active   atomic.Pointer[pipelineSet] // replaced on reload
 
-type statCounter struct {
-	Bytes, Messages uint64
-}
+	mu         sync.RWMutex // guards Config after startup
+	servers    map[string]chan struct{}
+	statsReset chan struct{}
 
-func (sc *statCounter) Add(n uint64) {
-	if sc == nil {
-		return
-	}
-	sc.Bytes += n
-	sc.Messages++
+	shutdownDeadline time.Time // set when input closes, before flushing
 }
 
-type statWriter struct {
-	wstats   *statCounter
-	errstats *statCounter
-	io.Writer
-}
-
-func (sw *statWriter) Write(p []byte) (n int, err error) {
-	n, err = sw.Writer.Write(p)
-	if err != nil {
-		sw.errstats.Add(uint64(n))
-		return
-	}
-	sw.wstats.Add(uint64(n))
-	return
-}
-
-type stats struct {
-	StartTime                             time.Time
-	DnstapIn, DnstapError, DnstapFiltered statCounter
-	QnameFiltered                         statCounter
-	NmsgOut                               statCounter
-	NmsgUp, NmsgError, NmsgDiscard        statCounter
-}
-
-func (s *stats) Log() {
-	log.Printf("Uptime: %s dnstap-input %d bytes / %d msgs; "+
-		"dnstap-error %d bytes / %d msgs; "+
-		"dnstap-filtered %d bytes / %d msgs; "+
-		"qname-filtered %d bytes / %d msgs; "+
-		"nmsg-out %d bytes / %d msgs; "+
-		"nmsg-up %d bytes / %d msgs; "+
-		"nmsg-error %d bytes / %d msgs; "+
-		"nmsg-discard %d bytes / %d msgs; ",
-		time.Duration(time.Since(s.StartTime).Seconds())*time.Second,
-		s.DnstapIn.Bytes, s.DnstapIn.Messages,
-		s.DnstapError.Bytes, s.DnstapError.Messages,
-		s.DnstapFiltered.Bytes, s.DnstapFiltered.Messages,
-		s.QnameFiltered.Bytes, s.QnameFiltered.Messages,
-		s.NmsgOut.Bytes, s.NmsgOut.Messages,
-		s.NmsgUp.Bytes, s.NmsgUp.Messages,
-		s.NmsgError.Bytes, s.NmsgError.Messages,
-		s.NmsgDiscard.Bytes, s.NmsgDiscard.Messages,
-	)
+// traceMsg logs per-message activity at debug level if tracing is enabled.
+func traceMsg(ctx *Context, msg string, kv ...interface{}) {
+	ctx.tracer.Log(msg, kv...)
 }
 
 func main() {
@@ -100,8 +50,30 @@ func main() {
 
 	ctx := new(Context)
 	ctx.Config, err = parseConfig(os.Args[1:])
+	if ctx.Config.PrintSchema {
+		if err := printSchema(os.Stdout); err != nil {
+			logFatal("Could not print schema", "error", err)
+		}
+		os.Exit(0)
+	}
+	if ctx.Config.CheckConfig || ctx.Config.PrintConfig {
+		os.Exit(checkConfig(ctx.Config, err))
+	}
 	if err != nil {
-		log.Fatal(err)
+		logFatal("Invalid configuration", "error", err)
+	}
+
+	level := ctx.Config.LogLevel
+	if ctx.Config.Trace && ctx.Config.TraceFile == "" && level > levelDebug {
+		level = levelDebug
+	}
+	defaultLogger.Configure(level, ctx.Config.LogFormat)
+
+	if ctx.Config.Trace {
+		ctx.tracer, err = newTracer(ctx.Config)
+		if err != nil {
+			logFatal("Could not open trace file", "file", ctx.Config.TraceFile, "error", err)
+		}
 	}
 
 	cconfig := &client.Config{
@@ -110,49 +82,178 @@ func main() {
 		APIKey:    ctx.Config.APIKey.String(),
 	}
 
+	cconfig.TLSConfig, err = loadTLSConfig(ctx.Config)
+	if err != nil {
+		logFatal("Invalid TLS configuration", "error", err)
+	}
+
+	ctx.notifier, err = newNotifier()
+	if err != nil {
+		logWarn("Could not open service notification socket", "error", err)
+	}
+
 	ctx.stats.StartTime = time.Now()
+	ctx.stats.register(&ctx.metrics)
 
 	if len(ctx.Config.Servers) > 0 {
-		ctx.Client = client.NewClient(cconfig)
+		ctx.Client = newClient(cconfig, proxyFunc(ctx.Config))
+		logInfo("Using API key", "key", keyFingerprint(cconfig.APIKey),
+			"file", apiKeyFile(&ctx.Config.APIKey))
+		go ctx.watchAPIKey(apiKeyInterval, nil)
 	}
-
 	for _, s := range ctx.Config.Servers {
-		if !strings.HasPrefix(s.Path, "/session/") {
-			s.Path = "/session/dnstap-sensor-upload"
-		}
-		go func(uri string) {
-			for {
-				log.Printf("Connecting to %s", uri)
-				log.Printf("%s: connection closed: %v", uri, ctx.Client.DialAndHandle(uri))
-				if ctx.Config.Retry.Duration == 0 {
-					log.Printf("No retry specified. Abandoning %s", uri)
-					return
-				}
-				<-time.After(ctx.Config.Retry.Duration)
-			}
-		}(s.String())
+		ctx.startServer(s.String())
 	}
 
-	if ctx.Config.UDPOutput.UDPAddr != nil {
-		conn, err := net.DialUDP("udp", nil, ctx.Config.UDPOutput.UDPAddr)
-		if err != nil {
-			log.Fatalf("Failed to dial %s: %v", ctx.Config.UDPOutput, err)
-		}
-		statConn := &statWriter{
-			Writer: conn,
-			wstats: &ctx.NmsgOut,
+	pipelines, err := ctx.newPipelines(ctx.Config)
+	if err != nil {
+		logFatal("Failed to dial UDP output", "error", err)
+	}
+	ctx.setPipelines(ctx.Config, pipelines)
+
+	if ctx.Config.MetricsListen != "" {
+		if err := serveMetrics(ctx); err != nil {
+			logFatal("Could not serve metrics",
+				"listen", ctx.Config.MetricsListen, "error", err)
 		}
-		ctx.Output = nmsg.TimedBufferedOutput(statConn, ctx.Config.Flush.Duration)
-		ctx.Output.SetSequenced(true)
-		ctx.Output.SetMaxSize(ctx.Config.MTU, ctx.Config.MTU)
 	}
 
-	ticker := time.NewTicker(ctx.Config.StatsInterval.Duration)
+	ctx.statsReset = make(chan struct{}, 1)
+	go logStats(ctx)
+	go ctx.handleReload(os.Args[1:])
+
+	runInputs(ctx, ctx.Config.inputs())
+	ctx.closeServers()
+	logInfo("Shutdown complete")
+}
+
+// config returns the current configuration. A reload replaces the
+// configuration rather than modifying it.
+func (ctx *Context) config() *Config {
+	ctx.mu.RLock()
+	defer ctx.mu.RUnlock()
+	return ctx.Config
+}
+
+// running returns the current pipelines and their outputs.
+func (ctx *Context) running() *pipelineSet {
+	if s := ctx.active.Load(); s != nil {
+		return s
+	}
+	return new(pipelineSet)
+}
+
+// setPipelines makes pipelines, created for conf, the current pipelines.
+func (ctx *Context) setPipelines(conf *Config, pipelines []*pipeline) {
+	ctx.active.Store(newPipelineSet(conf, pipelines))
+}
+
+// outputs returns the current UDP and sharded outputs.
+func (ctx *Context) outputs() ([]*udpOutput, []*shardedOutput) {
+	s := ctx.running()
+	return s.outputs, s.sharded
+}
+
+// pipelines returns the current pipelines.
+func (ctx *Context) pipelines() []*pipeline {
+	return ctx.running().pipelines
+}
+
+// startServer maintains a connection to the upload server at uri, retrying
+// after failures, until stopped with stopServer.
+func (ctx *Context) startServer(uri string) {
+	sc := ctx.Client.(*sensorClient)
+	stop := make(chan struct{})
+	ctx.mu.Lock()
+	if ctx.servers == nil {
+		ctx.servers = make(map[string]chan struct{})
+	}
+	ctx.servers[uri] = stop
+	ctx.mu.Unlock()
+
+	sc.Connect(uri)
+	sc.register(&ctx.metrics, uri)
+	name := redactedURI(uri)
 	go func() {
-		for _ = range ticker.C {
-			ctx.stats.Log()
+		for {
+			logInfo("Connecting to server", "server", name)
+			err := sc.DialAndHandle(uri)
+			select {
+			case <-stop:
+				logInfo("Server connection stopped", "server", name)
+				return
+			default:
+			}
+			logWarn("Server connection closed", "server", name, "error", err)
+			retry := ctx.config().Retry.Duration
+			if retry == 0 {
+				logWarn("No retry specified, abandoning server", "server", name)
+				return
+			}
+			select {
+			case <-time.After(retry):
+			case <-stop:
+				logInfo("Server connection stopped", "server", name)
+				return
+			}
 		}
 	}()
+}
+
+// stopServer closes the connection to the upload server at uri and stops
+// retrying it.
+func (ctx *Context) stopServer(uri string) {
+	ctx.mu.Lock()
+	stop := ctx.servers[uri]
+	delete(ctx.servers, uri)
+	ctx.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	sc := ctx.Client.(*sensorClient)
+	sc.Disconnect(uri)
+	ctx.metrics.Remove(map[string]string{"server": redactedURI(uri)})
+}
+
+// logStats logs statistics at the configured interval, restarting its
+// timer when signaled on ctx.statsReset.
+func logStats(ctx *Context) {
+	for {
+		var ticker *time.Ticker
+		var tick <-chan time.Time
+		if d := ctx.config().StatsInterval.Duration; d > 0 {
+			ticker = time.NewTicker(d)
+			tick = ticker.C
+		}
+	wait:
+		for {
+			select {
+			case <-tick:
+				ctx.logStats()
+			case <-ctx.statsReset:
+				break wait
+			}
+		}
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}
+}
 
-	ctx.Config.DnstapInput.run(ctx)
+func (ctx *Context) logStats() {
+	ctx.stats.Log()
+	ctx.conns.Log()
+	outputs, sharded := ctx.outputs()
+	for _, o := range outputs {
+		o.Log()
+	}
+	for _, o := range sharded {
+		o.Log()
+	}
+	if s := ctx.running(); s.named {
+		for _, p := range s.pipelines {
+			p.Log()
+		}
+	}
 }
@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metricsPrefix = "dnstap_sensor_"
+
+// Metric types
+const (
+	counterMetric = "counter"
+	gaugeMetric   = "gauge"
+)
+
+type metric struct {
+	name, typ, help string
+	labels          map[string]string
+	value           func() float64
+	owner           interface{} // nil unless registered by RegisterOwned
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (m *metric) labelString() string {
+	if len(m.labels) == 0 {
+		return ""
+	}
+	var keys []string
+	for k := range m.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var l []string
+	for _, k := range keys {
+		l = append(l, fmt.Sprintf(`%s="%s"`, k, labelEscaper.Replace(m.labels[k])))
+	}
+	return "{" + strings.Join(l, ",") + "}"
+}
+
+// A registry holds metrics exported in the Prometheus text format. Values
+// are computed by the registered functions when the metrics are scraped.
+// The zero value is an empty registry ready to use.
+type registry struct {
+	mu      sync.Mutex
+	metrics []*metric
+}
+
+// Register adds a metric with the given name, type, help text and labels,
+// whose value is returned by f. Metrics sharing a name must be registered
+// with the same type and help text, and differ in their labels. A metric
+// registered again with the same name and labels replaces the original.
+func (r *registry) Register(name, typ, help string, labels map[string]string, f func() float64) {
+	r.RegisterOwned(nil, name, typ, help, labels, f)
+}
+
+// RegisterOwned registers a metric as Register does, recording owner so
+// that RemoveOwner can remove it.
+func (r *registry) RegisterOwned(owner interface{}, name, typ, help string, labels map[string]string, f func() float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := &metric{metricsPrefix + name, typ, help, labels, f, owner}
+	for i, old := range r.metrics {
+		if old.name == m.name && old.labelString() == m.labelString() {
+			r.metrics[i] = m
+			return
+		}
+	}
+	r.metrics = append(r.metrics, m)
+}
+
+// Remove removes all metrics registered with exactly the given labels.
+func (r *registry) Remove(labels map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ls := (&metric{labels: labels}).labelString()
+	var keep []*metric
+	for _, m := range r.metrics {
+		if m.labelString() != ls {
+			keep = append(keep, m)
+		}
+	}
+	r.metrics = keep
+}
+
+// RemoveOwner removes the metrics registered by owner, leaving any which
+// have since been replaced by another owner's registration.
+func (r *registry) RemoveOwner(owner interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keep []*metric
+	for _, m := range r.metrics {
+		if m.owner != owner {
+			keep = append(keep, m)
+		}
+	}
+	r.metrics = keep
+}
+
+func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	metrics := make([]*metric, len(r.metrics))
+	copy(metrics, r.metrics)
+	r.mu.Unlock()
+
+	sort.SliceStable(metrics, func(i, j int) bool {
+		return metrics[i].name < metrics[j].name
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	bw := bufio.NewWriter(w)
+	for i, m := range metrics {
+		if i == 0 || metrics[i-1].name != m.name {
+			fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+			fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.typ)
+		}
+		fmt.Fprintf(bw, "%s%s %s\n", m.name, m.labelString(),
+			strconv.FormatFloat(m.value(), 'g', -1, 64))
+	}
+	bw.Flush()
+}
+
+// registerCounter registers the byte and message totals of a statCounter,
+// owned by owner if not nil.
+func (r *registry) registerCounter(owner interface{}, name, desc string, labels map[string]string, sc *statCounter) {
+	r.RegisterOwned(owner, name+"_bytes_total", counterMetric,
+		"Total bytes of "+desc+".", labels,
+		func() float64 { return float64(sc.Bytes()) })
+	r.RegisterOwned(owner, name+"_messages_total", counterMetric,
+		"Total messages of "+desc+".", labels,
+		func() float64 { return float64(sc.Messages()) })
+}
+
+func (s *stats) register(r *registry) {
+	r.registerCounter(nil, "dnstap_in", "dnstap input", nil, &s.DnstapIn)
+	r.registerCounter(nil, "dnstap_error", "dnstap input which failed to decode", nil, &s.DnstapError)
+	r.registerCounter(nil, "dnstap_filtered", "dnstap input filtered by message type", nil, &s.DnstapFiltered)
+	r.registerCounter(nil, "qname_filtered", "dnstap input filtered by qname", nil, &s.QnameFiltered)
+	r.registerCounter(nil, "nmsg_out", "NMSG output sent to UDP outputs", nil, &s.NmsgOut)
+	r.registerCounter(nil, "nmsg_up", "NMSG output queued for upload", nil, &s.NmsgUp)
+	r.registerCounter(nil, "nmsg_error", "NMSG conversion and output errors", nil, &s.NmsgError)
+	r.registerCounter(nil, "nmsg_discard", "NMSG upload payloads discarded", nil, &s.NmsgDiscard)
+	r.Register("uptime_seconds", gaugeMetric,
+		"Seconds since the sensor started.", nil,
+		func() float64 { return time.Since(s.StartTime).Seconds() })
+}
+
+func (h *inputHealth) register(r *registry, i dnstapInput) {
+	labels := map[string]string{"input": string(i)}
+	r.Register("input_idle", gaugeMetric,
+		"Whether the input has received no dnstap within the idle threshold.", labels,
+		func() float64 {
+			if h.Idle() {
+				return 1
+			}
+			return 0
+		})
+	r.Register("input_idle_total", counterMetric,
+		"Total times the input has become idle.", labels,
+		func() float64 { return float64(h.idleCount.Load()) })
+}
+
+func (cs *inputConns) register(r *registry, i dnstapInput) {
+	labels := map[string]string{"input": string(i)}
+	r.Register("input_connections", gaugeMetric,
+		"Open connections to the input socket.", labels,
+		func() float64 {
+			open, _ := cs.Input(i)
+			return float64(open)
+		})
+	r.Register("input_connections_total", counterMetric,
+		"Total connections accepted on the input socket.", labels,
+		func() float64 {
+			_, accepted := cs.Input(i)
+			return float64(accepted)
+		})
+}
+
+func (u *udpOutput) labels() map[string]string {
+	return map[string]string{
+		"output":   u.String(),
+		"pipeline": u.pipeline,
+		"index":    strconv.Itoa(u.index),
+	}
+}
+
+func (u *udpOutput) register(r *registry) {
+	labels := u.labels()
+	r.registerCounter(u, "udp_output_out", "NMSG output sent to the UDP output", labels, &u.Out)
+	r.registerCounter(u, "udp_output_error", "NMSG output which failed to send to the UDP output", labels, &u.Error)
+	r.registerCounter(u, "udp_output_discard", "NMSG output discarded while the UDP output was failed", labels, &u.Discard)
+	r.RegisterOwned(u, "udp_output_redials_total", counterMetric,
+		"Total re-dials of the UDP output after failure.", labels,
+		func() float64 { return float64(u.Redials.Load()) })
+}
+
+func (c *sensorClient) register(r *registry, uri string) {
+	labels := map[string]string{"server": redactedURI(uri)}
+	r.Register("server_connected", gaugeMetric,
+		"Whether the sensor is connected to the server.", labels,
+		func() float64 {
+			if c.Connected(uri) {
+				return 1
+			}
+			return 0
+		})
+}
+
+// serveMetrics listens on the configured metrics address and serves the
+// registered metrics over HTTP at /metrics, along with the /healthz and
+// /readyz health endpoints.
+func serveMetrics(ctx *Context) error {
+	l, err := net.Listen("tcp", ctx.Config.MetricsListen)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", &ctx.metrics)
+	mux.HandleFunc("/healthz", ctx.serveHealthz)
+	mux.HandleFunc("/readyz", ctx.serveReadyz)
+	go func() {
+		err := http.Serve(l, mux)
+		logError("Metrics server exited", "listen", l.Addr(), "error", err)
+	}()
+	return nil
+}
@@ -0,0 +1,302 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/farsightsec/go-config"
+	"github.com/farsightsec/go-nmsg"
+)
+
+const (
+	udpRetryMin = time.Second
+	udpRetryMax = time.Minute
+)
+
+// An output accepts NMSG payloads from the publishing goroutine.
+// nmsg.Output satisfies this interface.
+type output interface {
+	Send(*nmsg.NmsgPayload) error
+}
+
+// udpOutputConfig is the configuration of a single UDP output. Zero MTU
+// and Flush values are replaced with the global settings by parseConfig.
+// The multicast options apply only to multicast destinations, and are
+// left at the system defaults if unset.
+type udpOutputConfig struct {
+	Address   config.UDPAddr  `yaml:"address"`
+	MTU       int             `yaml:"mtu"`
+	Flush     config.Duration `yaml:"flush"`
+	TTL       int             `yaml:"multicast_ttl,omitempty"`
+	Interface string          `yaml:"multicast_interface,omitempty"`
+	Loopback  *bool           `yaml:"multicast_loopback,omitempty"`
+}
+
+func (oc *udpOutputConfig) validate() error {
+	if oc.Address.UDPAddr == nil {
+		return errors.New("no UDP output address specified")
+	}
+	if oc.Address.Port == 0 {
+		return errors.New("no UDP port specified")
+	}
+	if oc.MTU < nmsg.MinContainerSize || oc.MTU > nmsg.MaxContainerSize {
+		return fmt.Errorf("Invalid MTU %d for %s: must be between %d and %d",
+			oc.MTU, oc.Address,
+			nmsg.MinContainerSize,
+			nmsg.MaxContainerSize)
+	}
+	if oc.TTL < 0 || oc.TTL > 255 {
+		return fmt.Errorf("Invalid multicast TTL %d for %s: must be between 0 and 255",
+			oc.TTL, oc.Address)
+	}
+	if !oc.Address.IP.IsMulticast() &&
+		(oc.TTL != 0 || oc.Interface != "" || oc.Loopback != nil) {
+		return fmt.Errorf("multicast options specified for non-multicast address %s",
+			oc.Address)
+	}
+	return nil
+}
+
+// udpOutputList is a flag.Value accumulating UDP outputs from repeated
+// command line options. Each value is an address, optionally followed by
+// comma separated output settings, e.g.
+//
+//	udp:239.255.0.1:5353,mtu=9000,multicast_ttl=4
+type udpOutputList []udpOutputConfig
+
+func (l *udpOutputList) Set(s string) error {
+	items, opts, err := parseOptions(s)
+	if err != nil {
+		return err
+	}
+	if len(items) != 1 {
+		return fmt.Errorf("Invalid UDP output %s: must have one address", s)
+	}
+	opts["address"] = items[0]
+	var oc udpOutputConfig
+	if err := setOptions("udp_outputs", opts, &oc); err != nil {
+		return err
+	}
+	*l = append(*l, oc)
+	return nil
+}
+
+func (l *udpOutputList) String() string {
+	if l == nil {
+		return ""
+	}
+	var addrs []string
+	for _, oc := range *l {
+		addrs = append(addrs, oc.Address.String())
+	}
+	return strings.Join(addrs, " ")
+}
+
+// A udpOutput sends NMSG containers to a UDP destination. When a send
+// fails, the output discards payloads until a backoff interval has
+// passed, then re-dials its destination and resumes sending.
+type udpOutput struct {
+	ctx      *Context
+	label    string
+	pipeline string // name of the pipeline using the output
+	index    int    // of the output in the pipeline's outputs
+	udpOutputConfig
+
+	mu      sync.Mutex
+	conn    *net.UDPConn
+	out     nmsg.Output
+	retryAt time.Time
+	backoff time.Duration
+	wrote   int32 // set when a container write succeeds
+	closed  bool
+
+	Out, Error, Discard statCounter
+	Redials             atomic.Uint64
+}
+
+func newUDPOutput(ctx *Context, oc udpOutputConfig) (*udpOutput, error) {
+	u := &udpOutput{ctx: ctx, udpOutputConfig: oc}
+	return u, u.dial()
+}
+
+func (u *udpOutput) String() string {
+	if u.label != "" {
+		return u.label + " " + u.Address.String()
+	}
+	return u.Address.String()
+}
+
+// udpWriter records successful writes to a udpOutput's connection so
+// that the output can reset its backoff.
+type udpWriter struct {
+	u *udpOutput
+	io.Writer
+}
+
+func (w udpWriter) Write(p []byte) (n int, err error) {
+	n, err = w.Writer.Write(p)
+	if err == nil {
+		atomic.StoreInt32(&w.u.wrote, 1)
+	}
+	return
+}
+
+// setMulticastOptions applies the output's multicast options to conn.
+func (u *udpOutput) setMulticastOptions(conn *net.UDPConn) error {
+	var ifi *net.Interface
+	if u.Interface != "" {
+		var err error
+		ifi, err = net.InterfaceByName(u.Interface)
+		if err != nil {
+			return fmt.Errorf("multicast interface %s: %v", u.Interface, err)
+		}
+	}
+
+	if u.Address.IP.To4() != nil {
+		pc := ipv4.NewPacketConn(conn)
+		if u.TTL != 0 {
+			if err := pc.SetMulticastTTL(u.TTL); err != nil {
+				return err
+			}
+		}
+		if ifi != nil {
+			if err := pc.SetMulticastInterface(ifi); err != nil {
+				return err
+			}
+		}
+		if u.Loopback != nil {
+			return pc.SetMulticastLoopback(*u.Loopback)
+		}
+		return nil
+	}
+
+	pc := ipv6.NewPacketConn(conn)
+	if u.TTL != 0 {
+		if err := pc.SetMulticastHopLimit(u.TTL); err != nil {
+			return err
+		}
+	}
+	if ifi != nil {
+		if err := pc.SetMulticastInterface(ifi); err != nil {
+			return err
+		}
+	}
+	if u.Loopback != nil {
+		return pc.SetMulticastLoopback(*u.Loopback)
+	}
+	return nil
+}
+
+func (u *udpOutput) dial() error {
+	conn, err := net.DialUDP(u.Address.Network(), nil, u.Address.UDPAddr)
+	if err != nil {
+		return err
+	}
+	if u.Address.IP.IsMulticast() {
+		if err = u.setMulticastOptions(conn); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	statConn := &statWriter{
+		Writer: &statWriter{
+			Writer:   udpWriter{u, conn},
+			wstats:   &u.Out,
+			errstats: &u.Error,
+		},
+		wstats: &u.ctx.NmsgOut,
+	}
+	u.conn = conn
+	u.out = nmsg.TimedBufferedOutput(statConn, u.Flush.Duration)
+	u.out.SetSequenced(true)
+	u.out.SetMaxSize(u.MTU, u.MTU)
+	return nil
+}
+
+// fail closes the output's current connection and schedules a re-dial.
+// The backoff interval doubles with each consecutive failure, and resets
+// once a container has been written successfully.
+func (u *udpOutput) fail(err error) {
+	if u.conn != nil {
+		u.out.Close()
+		u.conn.Close()
+		u.conn, u.out = nil, nil
+	}
+	if atomic.SwapInt32(&u.wrote, 0) == 1 || u.backoff == 0 {
+		u.backoff = udpRetryMin
+	} else if u.backoff *= 2; u.backoff > udpRetryMax {
+		u.backoff = udpRetryMax
+	}
+	u.retryAt = time.Now().Add(u.backoff)
+	logWarn("UDP output failed", "output", u, "error", err, "retry", u.backoff)
+}
+
+// Send sends the payload to the output's destination. If the output has
+// failed and the retry interval has not passed, or the output is closed,
+// the payload is discarded.
+func (u *udpOutput) Send(p *nmsg.NmsgPayload) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.out == nil {
+		if u.closed || time.Now().Before(u.retryAt) {
+			u.Discard.Add(uint64(len(p.GetPayload())))
+			return nil
+		}
+		u.Redials.Add(1)
+		if err := u.dial(); err != nil {
+			u.fail(err)
+			return err
+		}
+		logInfo("UDP output reconnected", "output", u)
+	}
+	if err := u.out.Send(p); err != nil {
+		u.fail(err)
+		return err
+	}
+	return nil
+}
+
+// Close flushes any buffered payloads and closes the output's connection.
+// Payloads sent after Close are discarded.
+func (u *udpOutput) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.closed = true
+	if u.out == nil {
+		return nil
+	}
+	err := u.out.Close()
+	u.conn.Close()
+	u.conn, u.out = nil, nil
+	return err
+}
+
+func (u *udpOutput) Log() {
+	logInfo("UDP output stats",
+		"output", u,
+		"nmsg_out_bytes", u.Out.Bytes(),
+		"nmsg_out_msgs", u.Out.Messages(),
+		"nmsg_error_bytes", u.Error.Bytes(),
+		"nmsg_error_msgs", u.Error.Messages(),
+		"nmsg_discard_bytes", u.Discard.Bytes(),
+		"nmsg_discard_msgs", u.Discard.Messages(),
+		"redials", u.Redials.Load(),
+	)
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+
+	nmsg "github.com/farsightsec/go-nmsg"
+	"github.com/farsightsec/go-nmsg/nmsg_base"
+)
+
+func testPayload(t *testing.T) *nmsg.NmsgPayload {
+	d := new(nmsg_base.Dnstap)
+	d.Type = dnstap.Dnstap_MESSAGE.Enum()
+	p, err := nmsg.Payload(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestUDPOutputRecovery(t *testing.T) {
+	// Find a free port, and leave it closed so that sends elicit
+	// ICMP port unreachable errors.
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.LocalAddr().(*net.UDPAddr)
+	l.Close()
+
+	ctx := &Context{Config: &Config{}}
+	oc := udpOutputConfig{MTU: nmsg.EtherContainerSize}
+	oc.Address.UDPAddr = addr
+	oc.Flush.Duration = time.Millisecond
+	o, err := newUDPOutput(ctx, oc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	p := testPayload(t)
+	var errs int
+	for i := 0; i < 20; i++ {
+		if o.Send(p) != nil {
+			errs++
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if errs == 0 {
+		t.Fatal("no send errors to closed port")
+	}
+	if o.Discard.Messages() == 0 {
+		t.Error("no payloads discarded after send error")
+	}
+
+	l, err = net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Wait out the retry interval.
+	time.Sleep(udpRetryMin + 100*time.Millisecond)
+
+	out := o.Out.Messages()
+	for i := 0; i < 5; i++ {
+		if err := o.Send(p); err != nil {
+			t.Fatal("send failed after recovery: ", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, nmsg.EtherContainerSize)
+	if _, err := l.Read(buf); err != nil {
+		t.Fatal("no output received after recovery: ", err)
+	}
+	if o.Redials.Load() == 0 || o.Out.Messages() == out {
+		t.Errorf("redials %d, output messages %d", o.Redials.Load(), o.Out.Messages())
+	}
+}
+
+func TestUDPOutputMulticast(t *testing.T) {
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 0, 1)}
+	l, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		t.Skip("multicast unavailable: ", err)
+	}
+	defer l.Close()
+	group.Port = l.LocalAddr().(*net.UDPAddr).Port
+
+	loopback := true
+	oc := udpOutputConfig{MTU: nmsg.EtherContainerSize, TTL: 1, Loopback: &loopback}
+	oc.Address.UDPAddr = group
+	oc.Flush.Duration = time.Millisecond
+	o, err := newUDPOutput(&Context{Config: &Config{}}, oc)
+	if err != nil {
+		t.Skip("multicast unavailable: ", err)
+	}
+	defer o.Close()
+
+	if err := o.Send(testPayload(t)); err != nil {
+		t.Fatal(err)
+	}
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, nmsg.EtherContainerSize)
+	if _, err := l.Read(buf); err != nil {
+		t.Error("no multicast output received: ", err)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import "net"
+
+// peerCredentials is not supported on this platform.
+func peerCredentials(conn net.Conn) (*peerCred, error) {
+	return nil, nil
+}
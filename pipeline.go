@@ -0,0 +1,472 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/dnstap/golang-dnstap"
+	"gopkg.in/yaml.v2"
+
+	"github.com/farsightsec/go-config"
+	"github.com/farsightsec/go-nmsg/nmsg_base"
+)
+
+// defaultPipeline is the name of the pipeline of the global filter and
+// outputs, used when no pipelines are configured.
+const defaultPipeline = "default"
+
+// The transforms a pipeline may apply to its messages.
+const (
+	transformStripQueryAddress = "strip_query_address"
+	transformStripQueryMessage = "strip_query_message"
+	transformStripIdentity     = "strip_identity"
+)
+
+// pipelineConfig is the configuration of a named pipeline, which sends
+// the messages of the selected types from its inputs, less those
+// filtered by qname, to its outputs. A pipeline without inputs receives
+// messages from all inputs, and one without message types receives
+// resolver responses. InputIdle, if set, replaces the global idle
+// threshold for the pipeline's inputs.
+type pipelineConfig struct {
+	Name           string            `yaml:"name"`
+	Inputs         []dnstapInput     `yaml:"inputs,omitempty"`
+	InputIdle      *config.Duration  `yaml:"input_idle,omitempty"`
+	MessageTypes   []string          `yaml:"message_types,omitempty"`
+	FilterQnames   nameFilter        `yaml:"filter_qnames,omitempty"`
+	Transforms     []string          `yaml:"transforms,omitempty"`
+	Upload         bool              `yaml:"upload,omitempty"`
+	UDPOutputs     udpOutputList     `yaml:"udp_outputs,omitempty"`
+	ShardedOutputs shardedOutputList `yaml:"sharded_outputs,omitempty"`
+}
+
+// messageType returns the dnstap message type named, in lower case, in
+// the configuration.
+func messageType(name string) (dnstap.Message_Type, error) {
+	t, ok := dnstap.Message_Type_value[strings.ToUpper(name)]
+	if !ok || name != strings.ToLower(name) {
+		return 0, fmt.Errorf("Invalid message type %s", name)
+	}
+	return dnstap.Message_Type(t), nil
+}
+
+// messageTypes returns the names of the message types the pipeline
+// selects.
+func (pc *pipelineConfig) messageTypes() []string {
+	if len(pc.MessageTypes) == 0 {
+		return []string{"resolver_response"}
+	}
+	return pc.MessageTypes
+}
+
+// overlaps returns true if pc and other select messages of the same type
+// from the same input, regardless of their qname filters.
+func (pc *pipelineConfig) overlaps(other *pipelineConfig) bool {
+	var typ bool
+	for _, t := range pc.messageTypes() {
+		for _, ot := range other.messageTypes() {
+			typ = typ || t == ot
+		}
+	}
+	if !typ || len(pc.Inputs) == 0 || len(other.Inputs) == 0 {
+		return typ
+	}
+	for _, i := range pc.Inputs {
+		for _, oi := range other.Inputs {
+			if i == oi {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (pc *pipelineConfig) validate(conf *Config) error {
+	if pc.Name == "" {
+		return errors.New("no pipeline name specified")
+	}
+	for _, name := range pc.MessageTypes {
+		if _, err := messageType(name); err != nil {
+			return fmt.Errorf("pipeline %s: %v", pc.Name, err)
+		}
+	}
+	for _, t := range pc.Transforms {
+		switch t {
+		case transformStripQueryAddress, transformStripQueryMessage, transformStripIdentity:
+		default:
+			return fmt.Errorf("pipeline %s: Invalid transform %s", pc.Name, t)
+		}
+	}
+	for _, i := range pc.Inputs {
+		if i == "" {
+			return fmt.Errorf("pipeline %s: empty input", pc.Name)
+		}
+	}
+	if pc.InputIdle != nil && len(pc.Inputs) == 0 {
+		return fmt.Errorf("pipeline %s: input_idle specified but no inputs", pc.Name)
+	}
+	if pc.Upload && len(conf.Servers) == 0 {
+		return fmt.Errorf("pipeline %s: upload specified but no servers", pc.Name)
+	}
+	if !pc.Upload && len(pc.UDPOutputs) == 0 && len(pc.ShardedOutputs) == 0 {
+		return fmt.Errorf("pipeline %s: no upload or output specified", pc.Name)
+	}
+	for i := range pc.UDPOutputs {
+		if err := pc.UDPOutputs[i].validate(); err != nil {
+			return fmt.Errorf("pipeline %s: %v", pc.Name, err)
+		}
+	}
+	for i := range pc.ShardedOutputs {
+		if err := pc.ShardedOutputs[i].validate(); err != nil {
+			return fmt.Errorf("pipeline %s: %v", pc.Name, err)
+		}
+	}
+	return nil
+}
+
+// validatePipelines checks the configured pipelines, and that the global
+// filter and outputs, which pipelines replace, are not also configured.
+func (conf *Config) validatePipelines() error {
+	if len(conf.Pipelines) == 0 {
+		return nil
+	}
+	for key, set := range map[string]bool{
+		"udp_outputs":     len(conf.UDPOutputs) > 0,
+		"sharded_outputs": len(conf.ShardedOutputs) > 0,
+		"filter_qnames":   len(conf.FilterQnames) > 0,
+	} {
+		if set {
+			return fmt.Errorf("%s may not be used with pipelines", key)
+		}
+	}
+	names := make(map[string]bool)
+	idle := make(map[dnstapInput]*pipelineConfig)
+	var uploads []*pipelineConfig
+	for i := range conf.Pipelines {
+		pc := &conf.Pipelines[i]
+		if err := pc.validate(conf); err != nil {
+			return err
+		}
+		if names[pc.Name] {
+			return fmt.Errorf("duplicate pipeline name %s", pc.Name)
+		}
+		names[pc.Name] = true
+		for _, i := range pc.Inputs {
+			if pc.InputIdle == nil {
+				break
+			}
+			if o := idle[i]; o != nil && o.InputIdle.Duration != pc.InputIdle.Duration {
+				return fmt.Errorf("pipelines %s and %s set different input_idle for %s",
+					o.Name, pc.Name, i)
+			}
+			idle[i] = pc
+		}
+		if !pc.Upload {
+			continue
+		}
+		// Each message is uploaded at most once.
+		for _, up := range uploads {
+			if pc.overlaps(up) {
+				return fmt.Errorf("pipelines %s and %s both upload the same messages",
+					up.Name, pc.Name)
+			}
+		}
+		uploads = append(uploads, pc)
+	}
+	if len(conf.Servers) > 0 && len(uploads) == 0 {
+		return errors.New("servers specified but no pipeline uploads")
+	}
+	return nil
+}
+
+// pipelineConfigs returns the configured pipelines or, if there are none,
+// a single pipeline of the global filter and outputs, which uploads if
+// the sensor has servers.
+func (conf *Config) pipelineConfigs() []pipelineConfig {
+	if len(conf.Pipelines) > 0 {
+		return conf.Pipelines
+	}
+	return []pipelineConfig{{
+		Name:           defaultPipeline,
+		FilterQnames:   conf.FilterQnames,
+		Upload:         true,
+		UDPOutputs:     conf.UDPOutputs,
+		ShardedOutputs: conf.ShardedOutputs,
+	}}
+}
+
+// inputs returns the input sockets of the configuration: the global
+// input, if any, followed by the other inputs named by pipelines.
+func (conf *Config) inputs() []dnstapInput {
+	var inputs []dnstapInput
+	seen := make(map[dnstapInput]bool)
+	add := func(i dnstapInput) {
+		if i != "" && !seen[i] {
+			seen[i] = true
+			inputs = append(inputs, i)
+		}
+	}
+	add(conf.DnstapInput)
+	for _, pc := range conf.Pipelines {
+		for _, i := range pc.Inputs {
+			add(i)
+		}
+	}
+	return inputs
+}
+
+// idleThreshold returns the idle threshold of input i: that set by the
+// pipelines naming the input, if any, otherwise the global threshold.
+func (conf *Config) idleThreshold(i dnstapInput) time.Duration {
+	for _, pc := range conf.Pipelines {
+		if pc.InputIdle == nil {
+			continue
+		}
+		for _, pi := range pc.Inputs {
+			if pi == i {
+				return pc.InputIdle.Duration
+			}
+		}
+	}
+	return conf.InputIdle.Duration
+}
+
+// idleThresholds returns the idle threshold of each input.
+func (conf *Config) idleThresholds() map[dnstapInput]time.Duration {
+	thresholds := make(map[dnstapInput]time.Duration)
+	for _, i := range conf.inputs() {
+		thresholds[i] = conf.idleThreshold(i)
+	}
+	return thresholds
+}
+
+// pipelineList is a flag.Value accumulating pipelines from repeated
+// command line options. Each value is a pipeline configuration in YAML
+// flow style, e.g.
+//
+//	{name: local, message_types: [forwarder_response], udp_outputs: [{address: udp:127.0.0.1:5353}]}
+type pipelineList []pipelineConfig
+
+func (l *pipelineList) Set(s string) error {
+	var opts map[string]interface{}
+	if err := yaml.Unmarshal([]byte(s), &opts); err != nil || opts == nil {
+		return fmt.Errorf("Invalid pipeline %s: must be a YAML mapping", s)
+	}
+	var pc pipelineConfig
+	if err := setOptions("pipelines", opts, &pc); err != nil {
+		return err
+	}
+	*l = append(*l, pc)
+	return nil
+}
+
+func (l *pipelineList) String() string {
+	if l == nil {
+		return ""
+	}
+	var names []string
+	for _, pc := range *l {
+		names = append(names, pc.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+// pipelineStats counts the messages handled by a pipeline. They are kept
+// across reloads which do not remove the pipeline.
+type pipelineStats struct {
+	QnameFiltered, Out statCounter
+}
+
+// A pipeline is the running form of a pipelineConfig.
+type pipeline struct {
+	pipelineConfig
+	types   map[dnstap.Message_Type]bool
+	inputs  map[dnstapInput]bool // nil for all inputs
+	outputs []*udpOutput
+	sharded []*shardedOutput
+	*pipelineStats
+}
+
+// Selects returns true if the pipeline receives messages of type t from
+// input i.
+func (p *pipeline) Selects(i dnstapInput, t dnstap.Message_Type) bool {
+	return p.types[t] && (p.inputs == nil || p.inputs[i])
+}
+
+// Transform applies the pipeline's transforms to m.
+func (p *pipeline) Transform(m *nmsg_base.Dnstap) {
+	for _, t := range p.Transforms {
+		if m.Message == nil && t != transformStripIdentity {
+			continue
+		}
+		switch t {
+		case transformStripQueryAddress:
+			m.Message.QueryAddress = nil
+			m.Message.QueryPort = nil
+		case transformStripQueryMessage:
+			m.Message.QueryMessage = nil
+		case transformStripIdentity:
+			m.Identity = nil
+			m.Version = nil
+		}
+	}
+}
+
+func (p *pipeline) labels() map[string]string {
+	return map[string]string{"pipeline": p.Name}
+}
+
+func (p *pipeline) register(r *registry) {
+	labels := p.labels()
+	r.registerCounter(nil, "pipeline_qname_filtered", "pipeline input filtered by qname", labels, &p.QnameFiltered)
+	r.registerCounter(nil, "pipeline_out", "dnstap sent to pipeline outputs", labels, &p.Out)
+}
+
+func (p *pipeline) Log() {
+	logInfo("Pipeline stats", "pipeline", p.Name,
+		"qname_filtered_msgs", p.QnameFiltered.Messages(),
+		"out_msgs", p.Out.Messages(),
+		"out_bytes", p.Out.Bytes())
+}
+
+// A pipelineSet holds the pipelines of a configuration, with their
+// outputs and the settings read for each message, so that they may be
+// replaced together on reload.
+type pipelineSet struct {
+	pipelines []*pipeline
+	outputs   []*udpOutput
+	sharded   []*shardedOutput
+	named     bool          // set if pipelines are configured
+	flush     time.Duration // of the upload output
+}
+
+func newPipelineSet(conf *Config, pipelines []*pipeline) *pipelineSet {
+	s := &pipelineSet{
+		pipelines: pipelines,
+		named:     len(conf.Pipelines) > 0,
+		flush:     conf.Flush.Duration,
+	}
+	s.outputs, s.sharded = pipelineOutputs(pipelines)
+	return s
+}
+
+// pipelineOutputs returns the UDP and sharded outputs of all pipelines.
+func pipelineOutputs(pipelines []*pipeline) ([]*udpOutput, []*shardedOutput) {
+	var outputs []*udpOutput
+	var sharded []*shardedOutput
+	for _, p := range pipelines {
+		outputs = append(outputs, p.outputs...)
+		sharded = append(sharded, p.sharded...)
+	}
+	return outputs, sharded
+}
+
+// newPipelines returns the pipelines for conf, reusing any current
+// outputs with the same configuration and creating the rest.
+func (ctx *Context) newPipelines(conf *Config) ([]*pipeline, error) {
+	curOutputs, curSharded := ctx.outputs()
+	curStats := make(map[string]*pipelineStats)
+	for _, p := range ctx.pipelines() {
+		curStats[p.Name] = p.pipelineStats
+	}
+	reused := make(map[interface{}]bool)
+	var pipelines []*pipeline
+	var created []interface{ Close() error }
+	fail := func(err error) ([]*pipeline, error) {
+		for _, o := range created {
+			o.Close()
+		}
+		return nil, err
+	}
+
+	for _, pc := range conf.pipelineConfigs() {
+		p := &pipeline{
+			pipelineConfig: pc,
+			types:          make(map[dnstap.Message_Type]bool),
+			pipelineStats:  curStats[pc.Name],
+		}
+		if p.pipelineStats == nil {
+			p.pipelineStats = new(pipelineStats)
+		}
+		for _, name := range pc.messageTypes() {
+			t, err := messageType(name)
+			if err != nil {
+				return fail(err)
+			}
+			p.types[t] = true
+		}
+		if len(pc.Inputs) > 0 {
+			p.inputs = make(map[dnstapInput]bool)
+			for _, i := range pc.Inputs {
+				p.inputs[i] = true
+			}
+		}
+
+		// Outputs are labelled in metrics by pipeline and index, and
+		// reused only in the same place.
+	next:
+		for n, oc := range pc.UDPOutputs {
+			for _, o := range curOutputs {
+				if !reused[o] && o.pipeline == pc.Name && o.index == n &&
+					reflect.DeepEqual(o.udpOutputConfig, oc) {
+					reused[o] = true
+					p.outputs = append(p.outputs, o)
+					continue next
+				}
+			}
+			o, err := newUDPOutput(ctx, oc)
+			if err != nil {
+				return fail(fmt.Errorf("%s: %v", oc.Address, err))
+			}
+			o.pipeline, o.index = pc.Name, n
+			created = append(created, o)
+			p.outputs = append(p.outputs, o)
+		}
+
+	nextSharded:
+		for n, sc := range pc.ShardedOutputs {
+			for _, o := range curSharded {
+				if !reused[o] && o.usedBy(pc.Name, n) &&
+					reflect.DeepEqual(o.shardedOutputConfig, sc) {
+					reused[o] = true
+					p.sharded = append(p.sharded, o)
+					continue nextSharded
+				}
+			}
+			o, err := newShardedOutput(ctx, sc)
+			if err != nil {
+				return fail(fmt.Errorf("sharded output: %v", err))
+			}
+			o.setPipeline(pc.Name, n)
+			created = append(created, o)
+			p.sharded = append(p.sharded, o)
+		}
+		pipelines = append(pipelines, p)
+	}
+
+	for _, o := range created {
+		switch o := o.(type) {
+		case *udpOutput:
+			o.register(&ctx.metrics)
+		case *shardedOutput:
+			for _, so := range o.shards {
+				so.register(&ctx.metrics)
+			}
+		}
+	}
+	for _, p := range pipelines {
+		p.register(&ctx.metrics)
+	}
+	return pipelines, nil
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+
+	nmsg "github.com/farsightsec/go-nmsg"
+	"github.com/farsightsec/go-nmsg/nmsg_base"
+)
+
+func testFrame(t *testing.T, input dnstapInput, typ dnstap.Message_Type, qname string) frame {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, dns.TypeA)
+	m.Response = true
+	msg, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := proto.Marshal(&dnstap.Dnstap{
+		Type: dnstap.Dnstap_MESSAGE.Enum(),
+		Message: &dnstap.Message{
+			Type:            typ.Enum(),
+			QueryAddress:    net.IPv4(192, 0, 2, 1).To4(),
+			ResponseMessage: msg,
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame{input: input, data: b}
+}
+
+func TestPipelines(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conf := &Config{Channel: 203}
+	conf.Flush.Set("1h")
+	var filter nameFilter
+	filter.AddString("example.com")
+	oc := udpOutputConfig{MTU: nmsg.EtherContainerSize, Flush: conf.Flush}
+	oc.Address.UDPAddr = l.LocalAddr().(*net.UDPAddr)
+	conf.Pipelines = pipelineList{
+		{Name: "resolver", FilterQnames: filter, Upload: true},
+		{Name: "forwarder",
+			Inputs:       []dnstapInput{"forwarder.sock"},
+			MessageTypes: []string{"forwarder_response"},
+			Transforms:   []string{transformStripQueryAddress},
+			UDPOutputs:   udpOutputList{oc}},
+	}
+
+	tclient := new(sliceClient)
+	ctx := &Context{Client: tclient, Config: conf}
+	ctx.shutdownDeadline = time.Now().Add(time.Second)
+	pipelines, err := ctx.newPipelines(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.setPipelines(conf, pipelines)
+
+	ch := make(chan frame, 10)
+	ch <- testFrame(t, "resolver.sock", dnstap.Message_RESOLVER_RESPONSE, "www.example.net.")
+	ch <- testFrame(t, "resolver.sock", dnstap.Message_RESOLVER_RESPONSE, "www.example.com.")
+	ch <- testFrame(t, "forwarder.sock", dnstap.Message_FORWARDER_RESPONSE, "www.example.com.")
+	ch <- testFrame(t, "resolver.sock", dnstap.Message_FORWARDER_RESPONSE, "www.example.org.")
+	close(ch)
+	publish(ctx, ch)
+
+	if tclient.Len() != 1 {
+		t.Errorf("%d messages uploaded, expected 1", tclient.Len())
+	}
+	resolver, forwarder := pipelines[0], pipelines[1]
+	if resolver.Out.Messages() != 1 || resolver.QnameFiltered.Messages() != 1 {
+		t.Errorf("resolver pipeline sent %d, filtered %d, expected 1 and 1",
+			resolver.Out.Messages(), resolver.QnameFiltered.Messages())
+	}
+	if forwarder.Out.Messages() != 1 {
+		t.Errorf("forwarder pipeline sent %d, expected 1", forwarder.Out.Messages())
+	}
+	if ctx.DnstapFiltered.Messages() != 1 || ctx.QnameFiltered.Messages() != 1 {
+		t.Errorf("filtered %d by type and %d by qname, expected 1 and 1",
+			ctx.DnstapFiltered.Messages(), ctx.QnameFiltered.Messages())
+	}
+
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, nmsg.EtherContainerSize)
+	n, err := l.Read(buf)
+	if err != nil {
+		t.Fatal("no UDP output received: ", err)
+	}
+	p, err := nmsg.NewInput(bytes.NewReader(buf[:n]), n).Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := p.Message()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, ok := m.(*nmsg_base.Dnstap)
+	if !ok {
+		t.Fatalf("UDP output %T, expected dnstap", m)
+	}
+	if d.GetMessage().GetType() != dnstap.Message_FORWARDER_RESPONSE {
+		t.Errorf("UDP output of type %s", d.GetMessage().GetType())
+	}
+	if d.GetMessage().QueryAddress != nil {
+		t.Error("query address not stripped")
+	}
+	if up := tclient.msgs; len(up) == 1 && up[0].GetMessage().QueryAddress == nil {
+		t.Error("query address stripped from untransformed pipeline")
+	}
+}
+
+func TestPipelinesQnameFiltered(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conf := &Config{Channel: 203}
+	conf.Flush.Set("1h")
+	var com, both nameFilter
+	com.AddString("example.com")
+	both.AddString("example.com")
+	both.AddString("example.net")
+	oc := udpOutputConfig{MTU: nmsg.EtherContainerSize, Flush: conf.Flush}
+	oc.Address.UDPAddr = l.LocalAddr().(*net.UDPAddr)
+	conf.Pipelines = pipelineList{
+		{Name: "com", FilterQnames: com, Upload: true},
+		{Name: "both", FilterQnames: both, UDPOutputs: udpOutputList{oc}},
+	}
+
+	tclient := new(sliceClient)
+	ctx := &Context{Client: tclient, Config: conf}
+	ctx.shutdownDeadline = time.Now().Add(time.Second)
+	pipelines, err := ctx.newPipelines(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.setPipelines(conf, pipelines)
+
+	ch := make(chan frame, 10)
+	ch <- testFrame(t, "resolver.sock", dnstap.Message_RESOLVER_RESPONSE, "www.example.com.")
+	ch <- testFrame(t, "resolver.sock", dnstap.Message_RESOLVER_RESPONSE, "www.example.net.")
+	close(ch)
+	publish(ctx, ch)
+
+	// Only the message filtered by both pipelines counts as filtered.
+	if ctx.QnameFiltered.Messages() != 1 {
+		t.Errorf("filtered %d by qname, expected 1", ctx.QnameFiltered.Messages())
+	}
+	if tclient.Len() != 1 {
+		t.Errorf("%d messages uploaded, expected 1", tclient.Len())
+	}
+}
+
+func TestPipelineOutputMetrics(t *testing.T) {
+	conf := &Config{}
+	conf.Flush.Set("1h")
+	oc := udpOutputConfig{MTU: nmsg.EtherContainerSize, Flush: conf.Flush}
+	oc.Address.Set("udp:127.0.0.1:5353")
+	conf.Pipelines = pipelineList{
+		{Name: "a", UDPOutputs: udpOutputList{oc}},
+		{Name: "b", MessageTypes: []string{"client_query"}, UDPOutputs: udpOutputList{oc}},
+	}
+	ctx := &Context{Config: conf}
+	var err error
+	pipelines, err := ctx.newPipelines(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.setPipelines(conf, pipelines)
+	defer ctx.running().outputs[0].Close()
+
+	metric := func(pipeline string) string {
+		return metricsPrefix + `udp_output_out_messages_total{index="0",output="127.0.0.1:5353",pipeline="` +
+			pipeline + `"}`
+	}
+	get := func() string {
+		rec := httptest.NewRecorder()
+		ctx.metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		return rec.Body.String()
+	}
+	body := get()
+	for _, p := range []string{"a", "b"} {
+		if !strings.Contains(body, metric(p)) {
+			t.Errorf("missing output metrics of pipeline %s:\n%s", p, body)
+		}
+	}
+
+	// Removing one pipeline removes only its output's metrics.
+	conf2 := *conf
+	conf2.Pipelines = conf.Pipelines[:1]
+	pipelines, err = ctx.newPipelines(&conf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs, sharded := pipelineOutputs(pipelines)
+	ctx.closeUnused(ctx.running().outputs, ctx.running().sharded, outputs, sharded)
+	body = get()
+	if !strings.Contains(body, metric("a")) || strings.Contains(body, metric("b")) {
+		t.Errorf("expected output metrics of pipeline a only:\n%s", body)
+	}
+}
+
+func TestPipelineNoMessage(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conf := &Config{}
+	conf.Flush.Set("1h")
+	oc := udpOutputConfig{MTU: nmsg.EtherContainerSize, Flush: conf.Flush}
+	oc.Address.UDPAddr = l.LocalAddr().(*net.UDPAddr)
+	conf.Pipelines = pipelineList{
+		{Name: "auth",
+			MessageTypes: []string{"auth_query"},
+			Transforms: []string{transformStripQueryAddress,
+				transformStripQueryMessage, transformStripIdentity},
+			UDPOutputs: udpOutputList{oc}},
+	}
+	ctx := &Context{Config: conf}
+	ctx.shutdownDeadline = time.Now().Add(time.Second)
+	pipelines, err := ctx.newPipelines(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.setPipelines(conf, pipelines)
+
+	// A frame without a message reads as type AUTH_QUERY.
+	b, err := proto.Marshal(&dnstap.Dnstap{Type: dnstap.Dnstap_MESSAGE.Enum()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan frame, 1)
+	ch <- frame{input: "auth.sock", data: b}
+	close(ch)
+	publish(ctx, ch)
+
+	if ctx.DnstapFiltered.Messages() != 1 || pipelines[0].Out.Messages() != 0 {
+		t.Errorf("filtered %d, sent %d, expected frame without message filtered",
+			ctx.DnstapFiltered.Messages(), pipelines[0].Out.Messages())
+	}
+	pipelines[0].Transform(new(nmsg_base.Dnstap))
+}
+
+func TestPipelineInputIdle(t *testing.T) {
+	conf, err := parseConfig([]string{"-config", "t/config/pipelines.conf",
+		"-input_idle", "5m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, d := range map[dnstapInput]time.Duration{
+		"/tmp/resolver.sock":  5 * time.Minute,
+		"/tmp/forwarder.sock": time.Hour,
+	} {
+		if got := conf.idleThreshold(i); got != d {
+			t.Errorf("idle threshold of %s %s, expected %s", i, got, d)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// lookupUser returns the user and primary group ids and the supplementary
+// group ids of the named user, which may also be given as a user id.
+func lookupUser(name string) (uid, gid int, groups []int, err error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, nerr := strconv.Atoi(name); nerr != nil {
+			return 0, 0, nil, err
+		}
+		if u, err = user.LookupId(name); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	if uid, err = strconv.Atoi(u.Uid); err != nil {
+		return
+	}
+	if gid, err = strconv.Atoi(u.Gid); err != nil {
+		return
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		g, err := strconv.Atoi(id)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		groups = append(groups, g)
+	}
+	return
+}
+
+// dropPrivileges permanently changes the process's user and group to
+// those configured. The user's supplementary groups are kept, and its
+// primary group is used unless a group is configured. With only a group,
+// the user is not changed. dropPrivileges does nothing if neither is
+// configured.
+func dropPrivileges(conf *Config) error {
+	if conf.User == "" && conf.Group == "" {
+		return nil
+	}
+	uid, gid := -1, -1
+	var groups []int
+	var err error
+	if conf.User != "" {
+		uid, gid, groups, err = lookupUser(conf.User)
+		if err != nil {
+			return fmt.Errorf("user %s: %v", conf.User, err)
+		}
+	}
+	if conf.Group != "" {
+		if gid, err = lookupGroup(conf.Group); err != nil {
+			return fmt.Errorf("group %s: %v", conf.Group, err)
+		}
+		groups = append([]int{gid}, groups...)
+	}
+	if len(groups) == 0 {
+		groups = []int{gid}
+	}
+
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("setgroups: %v", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid %d: %v", gid, err)
+	}
+	if uid >= 0 {
+		if err := syscall.Setuid(uid); err != nil {
+			return fmt.Errorf("setuid %d: %v", uid, err)
+		}
+	}
+
+	if os.Getgid() != gid || os.Getegid() != gid {
+		return fmt.Errorf("group id %d not set", gid)
+	}
+	if uid >= 0 {
+		if os.Getuid() != uid || os.Geteuid() != uid {
+			return fmt.Errorf("user id %d not set", uid)
+		}
+		// Dropping privileges must be irreversible.
+		if uid != 0 && syscall.Setuid(0) == nil {
+			return errors.New("root privileges regained after setuid")
+		}
+	}
+	logInfo("Dropped privileges", "user", conf.User, "group", conf.Group,
+		"uid", os.Getuid(), "gid", os.Getgid())
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestLookupUser(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, name := range []string{u.Username, u.Uid} {
+		uid, gid, _, err := lookupUser(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if strconv.Itoa(uid) != u.Uid || strconv.Itoa(gid) != u.Gid {
+			t.Errorf("%s: uid %d gid %d, expected %s %s", name, uid, gid, u.Uid, u.Gid)
+		}
+	}
+	if _, _, _, err := lookupUser("no-such-user-dnstap-sensor"); err == nil {
+		t.Error("unknown user found")
+	}
+}
+
+// TestDropPrivilegesHelper runs in a child process started by
+// TestDropPrivileges, as dropping privileges is irreversible.
+func TestDropPrivilegesHelper(t *testing.T) {
+	name := os.Getenv("PRIVDROP_TEST_USER")
+	if name == "" {
+		t.Skip("helper process")
+	}
+	uid, _, _, err := lookupUser(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dropPrivileges(&Config{User: name}); err != nil {
+		t.Fatal(err)
+	}
+	if os.Getuid() != uid || os.Geteuid() != uid {
+		t.Errorf("running as %d/%d, expected %d", os.Getuid(), os.Geteuid(), uid)
+	}
+	if syscall.Setuid(0) == nil {
+		t.Error("regained root privileges")
+	}
+	if err := dropPrivileges(&Config{User: "root"}); err == nil {
+		t.Error("unprivileged user changed to root")
+	}
+}
+
+func TestDropPrivileges(t *testing.T) {
+	if err := dropPrivileges(new(Config)); err != nil {
+		t.Errorf("no user or group: %v", err)
+	}
+	if os.Getuid() != 0 {
+		t.Skip("not running as root")
+	}
+	if _, err := user.Lookup("nobody"); err != nil {
+		t.Skip(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=TestDropPrivilegesHelper", "-test.v")
+	cmd.Env = append(os.Environ(), "PRIVDROP_TEST_USER=nobody")
+	out, err := cmd.CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "--- PASS: TestDropPrivilegesHelper") {
+		t.Errorf("helper failed: %v\n%s", err, out)
+	}
+}
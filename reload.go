@@ -0,0 +1,273 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/farsightsec/go-config"
+	"gopkg.in/yaml.v2"
+)
+
+// restartSettings are the configuration settings which a reload cannot
+// change. Changes to them are logged and ignored until restart.
+var restartSettings = map[string]bool{
+	"dnstap_input":        true,
+	"input_socket_mode":   true,
+	"input_socket_group":  true,
+	"input_socket_remove": true,
+	"user":                true,
+	"group":               true,
+	"input_idle":          true,
+	"channel":             true,
+	"heartbeat":           true,
+	"tls_ca_file":         true,
+	"tls_cert_file":       true,
+	"tls_key_file":        true,
+	"tls_pin_sha256":      true,
+	"proxy":               true,
+	"metrics_listen":      true,
+	"trace":               true,
+	"trace_sample":        true,
+	"trace_rate":          true,
+	"trace_qnames":        true,
+	"trace_file":          true,
+}
+
+// A configChange describes a changed configuration setting.
+type configChange struct {
+	Key      string
+	Old, New string
+	field    int
+}
+
+// settingString formats a setting's value for logging, redacting secrets.
+func settingString(key string, v reflect.Value) string {
+	value := v.Interface()
+	switch key {
+	case "api_key":
+		if value.(*config.String).String() == "" {
+			return ""
+		}
+		return "(redacted)"
+	case "servers":
+		var servers []string
+		for _, u := range *value.(*[]config.URL) {
+			servers = append(servers, u.Redacted())
+		}
+		value = servers
+	case "proxy":
+		u := value.(*config.URL)
+		if u.URL == nil {
+			return ""
+		}
+		value = u.Redacted()
+	}
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return err.Error()
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "[]" || s == "{}" || s == "null" {
+		return ""
+	}
+	return s
+}
+
+// configChanges returns the settings which differ between old and conf.
+func configChanges(old, conf *Config) []configChange {
+	var changes []configChange
+	ov := reflect.ValueOf(old).Elem()
+	nv := reflect.ValueOf(conf).Elem()
+	for i := 0; i < nv.NumField(); i++ {
+		key := configKey(nv.Type().Field(i))
+		if key == "" {
+			continue
+		}
+		if reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		changes = append(changes, configChange{
+			Key:   key,
+			Old:   settingString(key, ov.Field(i).Addr()),
+			New:   settingString(key, nv.Field(i).Addr()),
+			field: i,
+		})
+	}
+	return changes
+}
+
+// handleReload reloads the configuration from args on each SIGHUP.
+func (ctx *Context) handleReload(args []string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		logInfo("Reloading configuration")
+		ctx.reload(args)
+	}
+}
+
+// reload parses and validates the configuration from args and applies any
+// changes to the running sensor. An invalid configuration is rejected,
+// leaving the current configuration in place.
+func (ctx *Context) reload(args []string) error {
+	conf, err := parseConfig(args)
+	if err != nil {
+		logError("Invalid configuration, keeping current configuration", "error", err)
+		return err
+	}
+	old := ctx.config()
+
+	changes := configChanges(old, conf)
+	if len(changes) == 0 {
+		logInfo("Configuration unchanged")
+		return nil
+	}
+
+	// Keep the current value of settings which cannot be changed.
+	nv := reflect.ValueOf(conf).Elem()
+	ov := reflect.ValueOf(old).Elem()
+	var applied []configChange
+	for _, c := range changes {
+		restart := restartSettings[c.Key]
+		if c.Key == "servers" && (len(old.Servers) == 0) != (len(conf.Servers) == 0) {
+			// Enabling or disabling upload requires restart.
+			restart = true
+		}
+		if c.Key == "pipelines" && (!reflect.DeepEqual(old.inputs(), conf.inputs()) ||
+			!reflect.DeepEqual(old.idleThresholds(), conf.idleThresholds())) {
+			// Adding or removing an input socket, or changing its
+			// idle threshold, requires restart.
+			restart = true
+		}
+		if restart {
+			logWarn("Configuration change requires restart, ignored",
+				"setting", c.Key, "old", c.Old, "new", c.New)
+			nv.Field(c.field).Set(ov.Field(c.field))
+			continue
+		}
+		applied = append(applied, c)
+	}
+	if len(applied) == 0 {
+		return nil
+	}
+	// Ignoring a setting may leave the others inconsistent with it.
+	if err := conf.validate(); err != nil {
+		logError("Invalid configuration without restart settings, keeping current configuration",
+			"error", err)
+		return err
+	}
+
+	pipelines, err := ctx.newPipelines(conf)
+	if err != nil {
+		logError("Could not apply configuration, keeping current configuration",
+			"error", err)
+		return err
+	}
+
+	ctx.mu.Lock()
+	prev := ctx.running()
+	ctx.Config = conf
+	ctx.setPipelines(conf, pipelines)
+	cur := ctx.running()
+	ctx.mu.Unlock()
+
+	ctx.closeUnused(prev.outputs, prev.sharded, cur.outputs, cur.sharded)
+	ctx.removePipelines(prev.pipelines, pipelines)
+	ctx.reloadServers(old, conf)
+	if old.APIKey.String() != conf.APIKey.String() {
+		ctx.setAPIKey(old.APIKey.String(), conf.APIKey.String())
+	}
+
+	level := conf.LogLevel
+	if conf.Trace && conf.TraceFile == "" && level > levelDebug {
+		level = levelDebug
+	}
+	defaultLogger.Configure(level, conf.LogFormat)
+
+	if old.StatsInterval != conf.StatsInterval {
+		select {
+		case ctx.statsReset <- struct{}{}:
+		default:
+		}
+	}
+
+	for _, c := range applied {
+		logInfo("Configuration changed", "setting", c.Key, "old", c.Old, "new", c.New)
+	}
+	return nil
+}
+
+// closeUnused closes the old outputs which are not among the current
+// outputs, and removes their metrics.
+func (ctx *Context) closeUnused(oldOutputs []*udpOutput, oldSharded []*shardedOutput,
+	outputs []*udpOutput, sharded []*shardedOutput) {
+	current := make(map[interface{}]bool)
+	for _, o := range outputs {
+		current[o] = true
+	}
+	for _, o := range sharded {
+		current[o] = true
+	}
+	for _, o := range oldOutputs {
+		if !current[o] {
+			o.Close()
+			ctx.metrics.RemoveOwner(o)
+		}
+	}
+	for _, o := range oldSharded {
+		if !current[o] {
+			o.Close()
+			for _, so := range o.shards {
+				ctx.metrics.RemoveOwner(so)
+			}
+		}
+	}
+}
+
+// removePipelines removes the metrics of the old pipelines which are not
+// among the current pipelines.
+func (ctx *Context) removePipelines(old, pipelines []*pipeline) {
+	current := make(map[string]bool)
+	for _, p := range pipelines {
+		current[p.Name] = true
+	}
+	for _, p := range old {
+		if !current[p.Name] {
+			ctx.metrics.Remove(p.labels())
+		}
+	}
+}
+
+// reloadServers connects to added servers and disconnects from removed
+// servers.
+func (ctx *Context) reloadServers(old, conf *Config) {
+	if ctx.Client == nil {
+		return
+	}
+	servers := make(map[string]bool)
+	for _, s := range conf.Servers {
+		servers[s.String()] = true
+	}
+	for _, s := range old.Servers {
+		if !servers[s.String()] {
+			ctx.stopServer(s.String())
+		}
+		delete(servers, s.String())
+	}
+	for _, s := range conf.Servers {
+		if servers[s.String()] {
+			ctx.startServer(s.String())
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// notifyStatusInterval is the maximum interval between STATUS updates
+// sent to the service manager.
+const notifyStatusInterval = 10 * time.Second
+
+// A notifier sends service state notifications to systemd over the
+// socket named by $NOTIFY_SOCKET, as described in sd_notify(3). A nil
+// *notifier discards notifications.
+type notifier struct {
+	conn     *net.UnixConn
+	stopping int32 // set once STOPPING=1 has been sent
+}
+
+// newNotifier returns a notifier for the socket named by $NOTIFY_SOCKET,
+// or nil if the variable is not set.
+func newNotifier() (*notifier, error) {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil, nil
+	}
+	if name[0] == '@' {
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil,
+		&net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &notifier{conn: conn}, nil
+}
+
+// Notify sends the given VARIABLE=value assignments in one datagram.
+func (n *notifier) Notify(state ...string) error {
+	if n == nil {
+		return nil
+	}
+	_, err := n.conn.Write([]byte(strings.Join(state, "\n")))
+	return err
+}
+
+// Stopping tells the service manager that the sensor is shutting down.
+func (n *notifier) Stopping() error {
+	if n == nil {
+		return nil
+	}
+	atomic.StoreInt32(&n.stopping, 1)
+	return n.Notify("STOPPING=1")
+}
+
+// isStopping returns true once Stopping has been called.
+func (n *notifier) isStopping() bool {
+	return n != nil && atomic.LoadInt32(&n.stopping) == 1
+}
+
+// watchdogInterval returns the watchdog timeout requested by the service
+// manager through $WATCHDOG_USEC, or zero if the watchdog is not enabled
+// for this process.
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// statusLine returns a STATUS assignment summarizing the sensor's
+// counters.
+func (ctx *Context) statusLine() string {
+	return fmt.Sprintf("STATUS=dnstap in %d, filtered %d, nmsg up %d, out %d, errors %d, discarded %d",
+		ctx.DnstapIn.Messages(),
+		ctx.DnstapFiltered.Messages()+ctx.QnameFiltered.Messages(),
+		ctx.NmsgUp.Messages(),
+		ctx.NmsgOut.Messages(),
+		ctx.DnstapError.Messages()+ctx.NmsgError.Messages(),
+		ctx.NmsgDiscard.Messages())
+}
+
+// pipelineAlive returns true if the input is listening and the input
+// queue is either empty or has been read from since the previous check,
+// when prevIn messages had been read.
+func (ctx *Context) pipelineAlive(prevIn uint64) bool {
+	if !ctx.health.Listening() {
+		return false
+	}
+	if ctx.health.queued == nil || ctx.health.queued() == 0 {
+		return true
+	}
+	return ctx.DnstapIn.Messages() != prevIn
+}
+
+// notifyReady tells the service manager that the sensor is ready, then
+// sends periodic status updates and, if the watchdog is enabled, keep-alive
+// pings while the pipeline is alive.
+func (ctx *Context) notifyReady() {
+	if ctx.notifier == nil {
+		return
+	}
+	if err := ctx.notifier.Notify("READY=1", ctx.statusLine()); err != nil {
+		logWarn("Service notification failed", "error", err)
+	}
+	go ctx.notifyLoop(watchdogInterval())
+}
+
+func (ctx *Context) notifyLoop(watchdog time.Duration) {
+	interval := notifyStatusInterval
+	if watchdog > 0 && watchdog/2 < interval {
+		interval = watchdog / 2
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	prevIn := ctx.DnstapIn.Messages()
+	for range ticker.C {
+		state := ctx.notifyState(watchdog > 0, prevIn)
+		prevIn = ctx.DnstapIn.Messages()
+		if err := ctx.notifier.Notify(state...); err != nil {
+			logWarn("Service notification failed", "error", err)
+		}
+	}
+}
+
+// notifyState returns the assignments of a periodic notification, with a
+// keep-alive ping if watchdog is set and the pipeline is alive. The input
+// stops listening on shutdown, so the pipeline is not checked once
+// STOPPING=1 has been sent.
+func (ctx *Context) notifyState(watchdog bool, prevIn uint64) []string {
+	state := []string{ctx.statusLine()}
+	if !watchdog {
+		return state
+	}
+	if ctx.notifier.isStopping() || ctx.pipelineAlive(prevIn) {
+		state = append(state, "WATCHDOG=1")
+	} else {
+		logWarn("Input pipeline stalled, withholding watchdog notification")
+	}
+	return state
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listenNotify(t *testing.T) *net.UnixConn {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotifyReady(t *testing.T) {
+	conn := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "")
+
+	ctx := &Context{Config: &Config{}}
+	var err error
+	ctx.notifier, err = newNotifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.DnstapIn.Add(100)
+	ctx.notifyReady()
+
+	msg := readNotify(t, conn)
+	if !strings.HasPrefix(msg, "READY=1\nSTATUS=") {
+		t.Errorf("unexpected notification %q", msg)
+	}
+	if !strings.Contains(msg, "dnstap in 1,") {
+		t.Errorf("status missing counters: %q", msg)
+	}
+}
+
+func TestNotifyUnset(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	n, err := newNotifier()
+	if n != nil || err != nil {
+		t.Errorf("newNotifier() = %v, %v, expected nil", n, err)
+	}
+	if err := n.Notify("READY=1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", "")
+	if d := watchdogInterval(); d != 30*time.Second {
+		t.Errorf("interval %s, expected 30s", d)
+	}
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if d := watchdogInterval(); d != 0 {
+		t.Errorf("interval %s for another process, expected 0", d)
+	}
+}
+
+func TestPipelineAlive(t *testing.T) {
+	ctx := &Context{Config: &Config{}}
+	queued := 0
+	ctx.health.queued = func() int { return queued }
+
+	if ctx.pipelineAlive(0) {
+		t.Error("alive before input listening")
+	}
+	ctx.health.setListening(true)
+	if !ctx.pipelineAlive(0) {
+		t.Error("not alive with empty queue")
+	}
+	queued = 10
+	if ctx.pipelineAlive(0) {
+		t.Error("alive with queued input and no progress")
+	}
+	ctx.DnstapIn.Add(100)
+	if !ctx.pipelineAlive(0) {
+		t.Error("not alive with queued input and progress")
+	}
+}
+
+func TestNotifyStopping(t *testing.T) {
+	conn := listenNotify(t)
+
+	ctx := &Context{Config: &Config{}}
+	var err error
+	ctx.notifier, err = newNotifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.health.queued = func() int { return 0 }
+	ctx.health.setListening(true)
+	if state := ctx.notifyState(true, 0); len(state) != 2 || state[1] != "WATCHDOG=1" {
+		t.Errorf("unexpected state %q while listening", state)
+	}
+
+	// The inputs stop listening on shutdown, after STOPPING=1.
+	if err := ctx.notifier.Stopping(); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readNotify(t, conn); msg != "STOPPING=1" {
+		t.Errorf("unexpected notification %q", msg)
+	}
+	ctx.health.setListening(false)
+	if state := ctx.notifyState(true, 0); len(state) != 2 || state[1] != "WATCHDOG=1" {
+		t.Errorf("unexpected state %q while stopping", state)
+	}
+	if state := ctx.notifyState(false, 0); len(state) != 1 {
+		t.Errorf("unexpected state %q without watchdog", state)
+	}
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/farsightsec/go-config"
+	"github.com/farsightsec/go-nmsg/nmsg_base"
+)
+
+// Shard keys
+const (
+	shardKeyQname           = "qname"
+	shardKeyResponseAddress = "response_address"
+)
+
+// shardedOutputConfig is the configuration of a group of UDP outputs
+// among which payloads are distributed by a hash of the shard key.
+type shardedOutputConfig struct {
+	Key          string           `yaml:"key"`
+	Destinations []config.UDPAddr `yaml:"destinations"`
+	MTU          int              `yaml:"mtu"`
+	Flush        config.Duration  `yaml:"flush"`
+}
+
+func (sc *shardedOutputConfig) validate() error {
+	switch sc.Key {
+	case shardKeyQname, shardKeyResponseAddress:
+	default:
+		return fmt.Errorf("Invalid shard key %s: must be %s or %s",
+			sc.Key, shardKeyQname, shardKeyResponseAddress)
+	}
+	if len(sc.Destinations) == 0 {
+		return errors.New("no sharded output destinations specified")
+	}
+	seen := make(map[string]bool)
+	for _, d := range sc.Destinations {
+		oc := sc.outputConfig(d)
+		if err := oc.validate(); err != nil {
+			return err
+		}
+		if seen[d.String()] {
+			return fmt.Errorf("duplicate sharded output destination %s", d)
+		}
+		seen[d.String()] = true
+	}
+	return nil
+}
+
+func (sc *shardedOutputConfig) outputConfig(dest config.UDPAddr) udpOutputConfig {
+	return udpOutputConfig{Address: dest, MTU: sc.MTU, Flush: sc.Flush}
+}
+
+// shardedOutputList is a flag.Value accumulating sharded outputs from
+// repeated command line options. Each value is a comma separated list of
+// destination addresses and output settings, e.g.
+//
+//	udp:127.0.0.1:5353,udp:127.0.0.1:5354,key=response_address
+type shardedOutputList []shardedOutputConfig
+
+func (l *shardedOutputList) Set(s string) error {
+	items, opts, err := parseOptions(s)
+	if err != nil {
+		return err
+	}
+	if _, ok := opts["destinations"]; ok {
+		return fmt.Errorf("Invalid sharded output %s: destinations must be given as addresses", s)
+	}
+	dests := make([]interface{}, len(items))
+	for i, item := range items {
+		dests[i] = item
+	}
+	opts["destinations"] = dests
+	var sc shardedOutputConfig
+	if err := setOptions("sharded_outputs", opts, &sc); err != nil {
+		return err
+	}
+	*l = append(*l, sc)
+	return nil
+}
+
+func (l *shardedOutputList) String() string {
+	if l == nil {
+		return ""
+	}
+	var outputs []string
+	for _, sc := range *l {
+		var dests []string
+		for _, d := range sc.Destinations {
+			dests = append(dests, d.String())
+		}
+		outputs = append(outputs, strings.Join(dests, ","))
+	}
+	return strings.Join(outputs, " ")
+}
+
+// A shardedOutput selects one of its UDP outputs for each message by
+// rendezvous hashing of the message's shard key, so that each output
+// receives a stable subset of keys, and adding or removing a destination
+// moves only the keys assigned to that destination.
+type shardedOutput struct {
+	shardedOutputConfig
+	key    string
+	shards []*udpOutput
+	seeds  []uint64
+}
+
+// setPipeline records the pipeline using the output, and the output's
+// index in the pipeline's sharded outputs, in each of its shards.
+func (s *shardedOutput) setPipeline(name string, index int) {
+	for _, o := range s.shards {
+		o.pipeline, o.index = name, index
+	}
+}
+
+// usedBy returns true if the output is the sharded output at index in the
+// named pipeline.
+func (s *shardedOutput) usedBy(name string, index int) bool {
+	return len(s.shards) > 0 && s.shards[0].pipeline == name && s.shards[0].index == index
+}
+
+func newShardedOutput(ctx *Context, sc shardedOutputConfig) (*shardedOutput, error) {
+	s := &shardedOutput{shardedOutputConfig: sc, key: sc.Key}
+	for i, d := range sc.Destinations {
+		o, err := newUDPOutput(ctx, sc.outputConfig(d))
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("%s: %v", d, err)
+		}
+		o.label = fmt.Sprintf("%s shard %d/%d", sc.Key, i+1, len(sc.Destinations))
+		s.shards = append(s.shards, o)
+		s.seeds = append(s.seeds, hashKey([]byte(d.String())))
+	}
+	return s, nil
+}
+
+func hashKey(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// mix is the splitmix64 finalizer, used to combine a key hash with a
+// destination seed.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// shardKey returns the bytes of m hashed to select a shard. Messages
+// without a parseable key all map to the shard selected for an empty key.
+func (s *shardedOutput) shardKey(m *nmsg_base.Dnstap) []byte {
+	msg := m.GetMessage()
+	if s.key == shardKeyResponseAddress {
+		return msg.GetResponseAddress()
+	}
+	name, _ := msgQname(dnsMessage(msg))
+	return name
+}
+
+// Select returns the output for message m.
+func (s *shardedOutput) Select(m *nmsg_base.Dnstap) *udpOutput {
+	h := hashKey(s.shardKey(m))
+	var best int
+	var max uint64
+	for i, seed := range s.seeds {
+		if w := mix(h ^ seed); i == 0 || w > max {
+			best, max = i, w
+		}
+	}
+	return s.shards[best]
+}
+
+func (s *shardedOutput) Close() error {
+	var err error
+	for _, o := range s.shards {
+		if cerr := o.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *shardedOutput) Log() {
+	for _, o := range s.shards {
+		o.Log()
+	}
+}
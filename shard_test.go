@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+
+	"github.com/farsightsec/go-config"
+	"github.com/farsightsec/go-nmsg/nmsg_base"
+)
+
+func testShardedOutput(t *testing.T, key string, ports ...int) *shardedOutput {
+	sc := shardedOutputConfig{Key: key, MTU: 1280}
+	for _, port := range ports {
+		var d config.UDPAddr
+		if err := d.Set(fmt.Sprintf("udp:127.0.0.1:%d", port)); err != nil {
+			t.Fatal(err)
+		}
+		sc.Destinations = append(sc.Destinations, d)
+	}
+	sc.Flush.Set("1s")
+	if err := sc.validate(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newShardedOutput(&Context{Config: &Config{}}, sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func qnameMessage(t *testing.T, name string) *nmsg_base.Dnstap {
+	msg := &dns.Msg{Question: []dns.Question{{Name: name}}}
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := new(nmsg_base.Dnstap)
+	m.Message = &dnstap.Message{ResponseMessage: b}
+	return m
+}
+
+func TestShardDistribution(t *testing.T) {
+	s := testShardedOutput(t, shardKeyQname, 5001, 5002, 5003, 5004)
+	defer s.Close()
+
+	const names = 10000
+	counts := make(map[*udpOutput]int)
+	assigned := make(map[string]*udpOutput)
+	for i := 0; i < names; i++ {
+		name := fmt.Sprintf("host%d.example.com.", i)
+		o := s.Select(qnameMessage(t, name))
+		counts[o]++
+		assigned[name] = o
+
+		if s.Select(qnameMessage(t, strings.ToUpper(name))) != o {
+			t.Fatalf("%s: case change selected different shard", name)
+		}
+	}
+
+	mean := names / len(s.shards)
+	for _, o := range s.shards {
+		if counts[o] < mean*8/10 || counts[o] > mean*12/10 {
+			t.Errorf("%s: %d of %d names, expected about %d", o, counts[o], names, mean)
+		}
+	}
+
+	// Removing a destination moves only the names assigned to it.
+	s3 := testShardedOutput(t, shardKeyQname, 5001, 5002, 5004)
+	defer s3.Close()
+	for name, o := range assigned {
+		if o.Address.Port == 5003 {
+			continue
+		}
+		if n := s3.Select(qnameMessage(t, name)); n.Address.Port != o.Address.Port {
+			t.Errorf("%s moved from %s to %s", name, o, n)
+		}
+	}
+}
+
+func TestShardResponseAddress(t *testing.T) {
+	s := testShardedOutput(t, shardKeyResponseAddress, 5001, 5002, 5003)
+	defer s.Close()
+
+	counts := make(map[*udpOutput]int)
+	for i := 0; i < 300; i++ {
+		m := qnameMessage(t, "example.com.")
+		m.Message.ResponseAddress = []byte{192, 0, 2, byte(i)}
+		counts[s.Select(m)]++
+	}
+	if len(counts) != len(s.shards) {
+		t.Errorf("response addresses distributed to %d of %d shards",
+			len(counts), len(s.shards))
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"time"
+
+	"github.com/farsightsec/go-nmsg"
+)
+
+// shutdownPoll is the interval at which shutdown checks whether server
+// connections have closed.
+const shutdownPoll = 50 * time.Millisecond
+
+// flushOutputs flushes the buffered payloads of the upload output, if
+// any, and of the UDP outputs, then waits until the shutdown deadline for
+// the last upload payload to be accepted by the client.
+func (ctx *Context) flushOutputs(upload nmsg.Output, pw *payloadWriter) {
+	if upload != nil {
+		if err := upload.Close(); err != nil {
+			logWarn("Could not flush upload output", "error", err)
+		}
+		if err := pw.Close(ctx.shutdownDeadline); err != nil {
+			logWarn("Could not complete upload", "error", err)
+		}
+	}
+	outputs, sharded := ctx.outputs()
+	for _, o := range outputs {
+		if err := o.Close(); err != nil {
+			logWarn("Could not flush UDP output", "output", o, "error", err)
+		}
+	}
+	for _, o := range sharded {
+		if err := o.Close(); err != nil {
+			logWarn("Could not flush sharded output", "error", err)
+		}
+	}
+}
+
+// closeServers tells the servers that the sensor has finished sending,
+// waits until the shutdown deadline for the server connections to close,
+// then closes any which remain open.
+func (ctx *Context) closeServers() {
+	sc, ok := ctx.Client.(*sensorClient)
+	if !ok {
+		return
+	}
+	sc.Finish()
+	for time.Now().Before(ctx.shutdownDeadline) && sc.anyConnected() {
+		time.Sleep(shutdownPoll)
+	}
+	ctx.mu.RLock()
+	var uris []string
+	for uri := range ctx.servers {
+		uris = append(uris, uri)
+	}
+	ctx.mu.RUnlock()
+	for _, uri := range uris {
+		ctx.stopServer(uri)
+	}
+	sc.Close()
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestShutdownFlush(t *testing.T) {
+	testMessage, err := proto.Marshal(
+		&dnstap.Dnstap{
+			Type: dnstap.Dnstap_MESSAGE.Enum(),
+			Message: &dnstap.Message{
+				Type: dnstap.Message_RESOLVER_RESPONSE.Enum(),
+			}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tclient := new(sliceClient)
+	ctx := &Context{
+		Client: tclient,
+		Config: &Config{Channel: 203},
+	}
+	// Long enough that nothing is sent before shutdown.
+	ctx.Config.Flush.Set("1h")
+	ctx.shutdownDeadline = time.Now().Add(time.Second)
+	pipelines, _ := ctx.newPipelines(ctx.Config)
+	ctx.setPipelines(ctx.Config, pipelines)
+
+	dtch := make(chan frame, 10)
+	for i := 0; i < 3; i++ {
+		dtch <- frame{input: "in", data: testMessage}
+	}
+	close(dtch)
+
+	done := make(chan struct{})
+	go func() {
+		publish(ctx, dtch)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish did not finish after input closed")
+	}
+	if tclient.Len() != 3 {
+		t.Errorf("%d messages uploaded at shutdown, expected 3", tclient.Len())
+	}
+}
+
+func TestShutdownUploadTimeout(t *testing.T) {
+	defaultLogger.SetOutput(ioutil.Discard)
+	defer defaultLogger.SetOutput(os.Stderr)
+
+	// An unread chanClient blocks Send indefinitely.
+	ctx := &Context{
+		Client: make(chanClient),
+		Config: &Config{Channel: 203},
+	}
+	pw := newPayloadWriter(ctx)
+	pw.Write([]byte("payload"))
+
+	start := time.Now()
+	err := pw.Close(start.Add(100 * time.Millisecond))
+	if err != errUploadTimeout {
+		t.Errorf("Close returned %v, expected timeout", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Close waited %s past deadline", d)
+	}
+}
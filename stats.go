@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2017, 2019, 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A statCounter counts messages and their total size in bytes. It may
+// be updated and read concurrently.
+type statCounter struct {
+	bytes, messages atomic.Uint64
+}
+
+func (sc *statCounter) Add(n uint64) {
+	if sc == nil {
+		return
+	}
+	sc.bytes.Add(n)
+	sc.messages.Add(1)
+}
+
+// Bytes returns the total bytes counted.
+func (sc *statCounter) Bytes() uint64 {
+	return sc.bytes.Load()
+}
+
+// Messages returns the total messages counted.
+func (sc *statCounter) Messages() uint64 {
+	return sc.messages.Load()
+}
+
+type statWriter struct {
+	wstats   *statCounter
+	errstats *statCounter
+	io.Writer
+}
+
+func (sw *statWriter) Write(p []byte) (n int, err error) {
+	n, err = sw.Writer.Write(p)
+	if err != nil {
+		sw.errstats.Add(uint64(n))
+		return
+	}
+	sw.wstats.Add(uint64(n))
+	return
+}
+
+type stats struct {
+	StartTime                             time.Time
+	DnstapIn, DnstapError, DnstapFiltered statCounter
+	QnameFiltered                         statCounter
+	NmsgOut                               statCounter
+	NmsgUp, NmsgError, NmsgDiscard        statCounter
+
+	mu   sync.Mutex
+	last statsSnapshot // snapshot of the previous Log
+}
+
+type namedCounter struct {
+	name string
+	*statCounter
+}
+
+// counters returns the stats counters in logging order, with their names.
+func (s *stats) counters() []namedCounter {
+	return []namedCounter{
+		{"dnstap-input", &s.DnstapIn},
+		{"dnstap-error", &s.DnstapError},
+		{"dnstap-filtered", &s.DnstapFiltered},
+		{"qname-filtered", &s.QnameFiltered},
+		{"nmsg-out", &s.NmsgOut},
+		{"nmsg-up", &s.NmsgUp},
+		{"nmsg-error", &s.NmsgError},
+		{"nmsg-discard", &s.NmsgDiscard},
+	}
+}
+
+// A counterSnapshot holds the value of a statCounter at the time of a
+// statsSnapshot, and its average rates over the snapshot's Interval.
+type counterSnapshot struct {
+	Name                  string
+	Bytes, Messages       uint64
+	ByteRate, MessageRate float64 // per second
+}
+
+// A statsSnapshot holds the values of all stats counters at Time.
+//
+// Each counter is read atomically, but counters are not read at exactly
+// the same instant, so a message being processed during the snapshot
+// may be reflected in some counters and not others.
+type statsSnapshot struct {
+	Time     time.Time
+	Uptime   time.Duration
+	Interval time.Duration // since the previous snapshot, if any
+	Counters []counterSnapshot
+}
+
+// Snapshot returns the current values of all counters.
+func (s *stats) Snapshot() statsSnapshot {
+	now := time.Now()
+	snap := statsSnapshot{
+		Time:   now,
+		Uptime: now.Sub(s.StartTime),
+	}
+	for _, c := range s.counters() {
+		snap.Counters = append(snap.Counters, counterSnapshot{
+			Name:     c.name,
+			Bytes:    c.Bytes(),
+			Messages: c.Messages(),
+		})
+	}
+	return snap
+}
+
+// Since returns a copy of snap with Interval and counter rates computed
+// relative to the earlier snapshot prev. If prev is the zero snapshot,
+// rates are computed since StartTime.
+func (snap statsSnapshot) Since(prev statsSnapshot) statsSnapshot {
+	res := snap
+	res.Counters = make([]counterSnapshot, len(snap.Counters))
+	copy(res.Counters, snap.Counters)
+
+	res.Interval = snap.Uptime
+	if !prev.Time.IsZero() {
+		res.Interval = snap.Time.Sub(prev.Time)
+	}
+	secs := res.Interval.Seconds()
+	if secs <= 0 {
+		return res
+	}
+	for i := range res.Counters {
+		c := &res.Counters[i]
+		var pb, pm uint64
+		if i < len(prev.Counters) {
+			pb, pm = prev.Counters[i].Bytes, prev.Counters[i].Messages
+		}
+		c.ByteRate = float64(c.Bytes-pb) / secs
+		c.MessageRate = float64(c.Messages-pm) / secs
+	}
+	return res
+}
+
+// Counter returns the snapshot of the named counter.
+func (snap statsSnapshot) Counter(name string) counterSnapshot {
+	for _, c := range snap.Counters {
+		if c.Name == name {
+			return c
+		}
+	}
+	return counterSnapshot{Name: name}
+}
+
+// logFields returns the snapshot as alternating keys and values for
+// structured logging.
+func (snap statsSnapshot) logFields() []interface{} {
+	kv := []interface{}{"uptime", snap.Uptime.Truncate(time.Second)}
+	for _, c := range snap.Counters {
+		name := strings.Replace(c.Name, "-", "_", -1)
+		kv = append(kv,
+			name+"_bytes", c.Bytes,
+			name+"_msgs", c.Messages,
+			name+"_rate", math.Round(c.MessageRate*10)/10)
+	}
+	return kv
+}
+
+// Log logs a snapshot of the stats, with rates computed over the
+// interval since the previous call to Log.
+func (s *stats) Log() {
+	s.mu.Lock()
+	snap := s.Snapshot().Since(s.last)
+	s.last = snap
+	s.mu.Unlock()
+	logInfo("stats", snap.logFields()...)
+}
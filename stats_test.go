@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatsConcurrent(t *testing.T) {
+	defaultLogger.SetOutput(ioutil.Discard)
+	defer defaultLogger.SetOutput(os.Stderr)
+
+	s := new(stats)
+	s.StartTime = time.Now()
+	var r registry
+	s.register(&r)
+
+	const writers, adds = 8, 1000
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < adds; j++ {
+				s.DnstapIn.Add(10)
+				s.NmsgOut.Add(1)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			s.Log()
+			s.Snapshot()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+		}
+	}()
+
+	wg.Wait()
+	<-done
+
+	snap := s.Snapshot()
+	in := snap.Counter("dnstap-input")
+	if in.Messages != writers*adds || in.Bytes != 10*writers*adds {
+		t.Errorf("dnstap-input %d bytes / %d msgs, expected %d / %d",
+			in.Bytes, in.Messages, 10*writers*adds, writers*adds)
+	}
+	if out := snap.Counter("nmsg-out"); out.Messages != writers*adds {
+		t.Errorf("nmsg-out %d msgs, expected %d", out.Messages, writers*adds)
+	}
+}
+
+func TestStatsRates(t *testing.T) {
+	s := new(stats)
+	s.StartTime = time.Now().Add(-10 * time.Second)
+	for i := 0; i < 20; i++ {
+		s.DnstapIn.Add(100)
+	}
+
+	first := s.Snapshot().Since(statsSnapshot{})
+	if c := first.Counter("dnstap-input"); c.MessageRate < 1.9 || c.MessageRate > 2.0 {
+		t.Errorf("initial rate %f msgs/s, expected about 2", c.MessageRate)
+	}
+
+	for i := 0; i < 10; i++ {
+		s.DnstapIn.Add(100)
+	}
+	next := s.Snapshot()
+	next.Time = first.Time.Add(5 * time.Second)
+	next = next.Since(first)
+	if next.Interval != 5*time.Second {
+		t.Errorf("interval %s, expected 5s", next.Interval)
+	}
+	c := next.Counter("dnstap-input")
+	if c.MessageRate != 2 || c.ByteRate != 200 {
+		t.Errorf("rate %f msgs/s %f bytes/s, expected 2 / 200",
+			c.MessageRate, c.ByteRate)
+	}
+	if c := next.Counter("nmsg-out"); c.MessageRate != 0 {
+		t.Errorf("nmsg-out rate %f, expected 0", c.MessageRate)
+	}
+}
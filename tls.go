@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// pinPrefix is an optional prefix on SPKI pins, as accepted by curl's
+// --pinnedpubkey option.
+const pinPrefix = "sha256//"
+
+// parsePin decodes a base64-encoded SHA-256 hash of a certificate's
+// SubjectPublicKeyInfo.
+func parsePin(s string) ([]byte, error) {
+	pin, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, pinPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SPKI pin %s: %v", s, err)
+	}
+	if len(pin) != sha256.Size {
+		return nil, fmt.Errorf("Invalid SPKI pin %s: length %d, expected %d",
+			s, len(pin), sha256.Size)
+	}
+	return pin, nil
+}
+
+func spkiHash(cert *x509.Certificate) []byte {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return h[:]
+}
+
+var errPinMismatch = errors.New("server certificate chain does not match any configured SPKI pin")
+
+// verifyPins returns a function suitable for tls.Config.VerifyPeerCertificate
+// which succeeds if any certificate in the server's chain has a public key
+// matching one of the supplied pins.
+func verifyPins(pins [][]byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+		var certs []*x509.Certificate
+		for _, chain := range chains {
+			certs = append(certs, chain...)
+		}
+		if len(chains) == 0 {
+			for _, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs = append(certs, cert)
+			}
+		}
+		for _, cert := range certs {
+			h := spkiHash(cert)
+			for _, pin := range pins {
+				if bytes.Equal(h, pin) {
+					return nil
+				}
+			}
+		}
+		return errPinMismatch
+	}
+}
+
+// loadTLSConfig builds the TLS configuration used for wss:// server
+// connections. It returns nil if no TLS options are configured, leaving
+// the client to use the system defaults.
+func loadTLSConfig(conf *Config) (*tls.Config, error) {
+	if conf.TLSCAFile == "" && conf.TLSCertFile == "" && len(conf.TLSPins) == 0 {
+		return nil, nil
+	}
+
+	tc := new(tls.Config)
+
+	if conf.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(conf.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read CA file: %v", err)
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in CA file %s",
+				conf.TLSCAFile)
+		}
+	}
+
+	if conf.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.TLSCertFile, conf.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load client certificate %s with key %s: %v",
+				conf.TLSCertFile, conf.TLSKeyFile, err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(conf.TLSPins) > 0 {
+		var pins [][]byte
+		for _, s := range conf.TLSPins {
+			pin, err := parsePin(s)
+			if err != nil {
+				return nil, err
+			}
+			pins = append(pins, pin)
+		}
+		tc.VerifyPeerCertificate = verifyPins(pins)
+	}
+
+	return tc, nil
+}
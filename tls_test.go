@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth,
+		},
+	}
+	signer, signKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert, key, der}
+}
+
+func (tc *testCert) writeFiles(t *testing.T, dir, name string) (certFile, keyFile string) {
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.der})
+	kb, err := x509.MarshalECPrivateKey(tc.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func (tc *testCert) pin() string {
+	return base64.StdEncoding.EncodeToString(spkiHash(tc.cert))
+}
+
+// handshake runs a TLS handshake between a server using the given
+// certificate, requiring a client certificate signed by ca, and a client
+// using clientConf.
+func handshake(server, ca *testCert, clientConf *tls.Config) error {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	sconf := &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{server.der},
+			PrivateKey:  server.key,
+		}},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	serr := make(chan error, 1)
+	go func() {
+		sc, err := l.Accept()
+		if err != nil {
+			serr <- err
+			return
+		}
+		s := tls.Server(sc, sconf)
+		serr <- s.Handshake()
+		s.Close()
+	}()
+	cc, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		return err
+	}
+	c := tls.Client(cc, clientConf)
+	err = c.Handshake()
+	c.Close()
+	if err != nil {
+		return err
+	}
+	return <-serr
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil)
+	server := newTestCert(t, "relay.example", ca)
+	client := newTestCert(t, "sensor.example", ca)
+	other := newTestCert(t, "other.example", ca)
+
+	caFile, _ := ca.writeFiles(t, dir, "ca")
+	certFile, keyFile := client.writeFiles(t, dir, "client")
+	_, otherKeyFile := other.writeFiles(t, dir, "other")
+
+	conf := &Config{TLSCAFile: caFile, TLSCertFile: certFile, TLSKeyFile: keyFile}
+	tc, err := loadTLSConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.ServerName = "relay.example"
+	if err := handshake(server, ca, tc); err != nil {
+		t.Error("handshake failed: ", err)
+	}
+
+	t.Run("pin match", func(t *testing.T) {
+		conf := *conf
+		conf.TLSPins = stringList{other.pin(), pinPrefix + server.pin()}
+		tc, err := loadTLSConfig(&conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.ServerName = "relay.example"
+		if err := handshake(server, ca, tc); err != nil {
+			t.Error("handshake failed: ", err)
+		}
+	})
+
+	t.Run("pin mismatch", func(t *testing.T) {
+		conf := *conf
+		conf.TLSPins = stringList{other.pin()}
+		tc, err := loadTLSConfig(&conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.ServerName = "relay.example"
+		if err := handshake(server, ca, tc); err == nil {
+			t.Error("handshake succeeded with mismatched pin")
+		}
+	})
+
+	errCases := []struct {
+		Name string
+		Conf Config
+	}{
+		{"missing CA", Config{TLSCAFile: filepath.Join(dir, "nonexistent")}},
+		{"CA without certificates", Config{TLSCAFile: keyFile}},
+		{"mismatched key", Config{TLSCertFile: certFile, TLSKeyFile: otherKeyFile}},
+		{"missing key", Config{TLSCertFile: certFile, TLSKeyFile: filepath.Join(dir, "nonexistent")}},
+		{"invalid pin", Config{TLSPins: stringList{"not-a-pin"}}},
+	}
+	for _, ec := range errCases {
+		_, err := loadTLSConfig(&ec.Conf)
+		if err == nil {
+			t.Errorf("%s: no error", ec.Name)
+			continue
+		}
+		t.Logf("%s - %v", ec.Name, err)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dnstap/golang-dnstap"
+
+	"github.com/farsightsec/go-nmsg/nmsg_base"
+)
+
+// A tracer writes trace records for the messages selected by its qname
+// list and sample rate, limited to a maximum number of records per second.
+// A nil *tracer traces nothing.
+type tracer struct {
+	*logger
+	names  nameFilter
+	sample uint64
+	rate   int
+
+	seen   atomic.Uint64 // messages considered for sampling
+	frames atomic.Uint64 // frames considered for sampling
+
+	mu         sync.Mutex
+	window     time.Time
+	count      int
+	suppressed uint64
+}
+
+func newTracer(conf *Config) (*tracer, error) {
+	t := &tracer{
+		logger: defaultLogger,
+		names:  conf.TraceQnames,
+		sample: uint64(conf.TraceSample),
+		rate:   conf.TraceRate,
+	}
+	if conf.TraceFile != "" {
+		f, err := os.OpenFile(conf.TraceFile,
+			os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		t.logger = &logger{out: f, level: levelDebug, format: conf.LogFormat}
+	}
+	return t, nil
+}
+
+// Select returns true if message m should be traced. A nil m, for an
+// undecodable message, is selected only if no qnames are configured.
+func (t *tracer) Select(m *nmsg_base.Dnstap) bool {
+	if t == nil {
+		return false
+	}
+	if t.names != nil {
+		if m == nil {
+			return false
+		}
+		if ok, _ := t.names.FilterMsgQname(dnsMessage(m.GetMessage())); !ok {
+			return false
+		}
+	}
+	return t.sampled(&t.seen)
+}
+
+// SelectFrame returns true if a received frame, whose qname is not yet
+// known, should be traced. Frames are selected only if no qnames are
+// configured, and are sampled separately from messages.
+func (t *tracer) SelectFrame() bool {
+	if t == nil || t.names != nil {
+		return false
+	}
+	return t.sampled(&t.frames)
+}
+
+func (t *tracer) sampled(counter *atomic.Uint64) bool {
+	if t.sample <= 1 {
+		return true
+	}
+	return counter.Add(1)%t.sample == 1
+}
+
+// allow returns true if another trace record may be written in the
+// current one second window. When a new window starts, the number of
+// records suppressed in the previous window, if any, is logged.
+func (t *tracer) allow() bool {
+	if t.rate <= 0 {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if now.Sub(t.window) >= time.Second {
+		if t.suppressed > 0 {
+			t.logger.Log(levelDebug, "Trace output rate limited",
+				"suppressed", t.suppressed, "limit", t.rate)
+		}
+		t.window, t.count, t.suppressed = now, 0, 0
+	}
+	if t.count >= t.rate {
+		t.suppressed++
+		return false
+	}
+	t.count++
+	return true
+}
+
+// Log writes a trace record, subject to the rate limit.
+func (t *tracer) Log(msg string, kv ...interface{}) {
+	if t == nil || !t.allow() {
+		return
+	}
+	t.logger.Log(levelDebug, msg, kv...)
+}
+
+// LogDnstap writes a trace record including the text form of m and any
+// further keys and values, subject to the rate limit.
+func (t *tracer) LogDnstap(msg string, m *nmsg_base.Dnstap, kv ...interface{}) {
+	if t == nil || !t.allow() {
+		return
+	}
+	b, ok := dnstap.TextFormat(&m.Dnstap)
+	if !ok {
+		t.logger.Log(levelDebug, msg, append(kv, "error", "formatting failed")...)
+		return
+	}
+	t.logger.Log(levelDebug, msg, append(kv, "message", string(b))...)
+}
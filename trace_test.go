@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnstap/golang-dnstap"
+)
+
+func TestTraceSample(t *testing.T) {
+	tr := &tracer{sample: 4}
+	var n int
+	for i := 0; i < 20; i++ {
+		if tr.Select(qnameMessage(t, "example.com.")) {
+			n++
+		}
+	}
+	if n != 5 {
+		t.Errorf("selected %d of 20 messages, expected 5", n)
+	}
+
+	var nilTracer *tracer
+	if nilTracer.Select(qnameMessage(t, "example.com.")) {
+		t.Error("nil tracer selected message")
+	}
+}
+
+func TestTraceQnames(t *testing.T) {
+	tr := &tracer{}
+	tr.names.AddString("example.com")
+
+	for name, expect := range map[string]bool{
+		"example.com.":     true,
+		"www.example.com.": true,
+		"example.net.":     false,
+	} {
+		if tr.Select(qnameMessage(t, name)) != expect {
+			t.Errorf("Select(%s) != %v", name, expect)
+		}
+	}
+	if tr.Select(nil) {
+		t.Error("undecodable message selected with qname list")
+	}
+}
+
+func TestTraceRate(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tr := &tracer{
+		logger: &logger{out: buf, level: levelDebug, format: logFormatText},
+		rate:   2,
+	}
+	for i := 0; i < 5; i++ {
+		tr.Log("trace", "i", i)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("%d lines written, expected 2:\n%s", n, buf)
+	}
+
+	buf.Reset()
+	tr.window = tr.window.Add(-time.Second)
+	tr.Log("trace", "i", 5)
+	expect := "level=debug msg=\"Trace output rate limited\" suppressed=3 limit=2\n" +
+		"level=debug msg=trace i=5\n"
+	if buf.String() != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf, expect)
+	}
+}
+
+func TestTraceFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stderr := new(bytes.Buffer)
+	defaultLogger.SetOutput(stderr)
+	defer defaultLogger.SetOutput(os.Stderr)
+
+	conf := &Config{TraceFile: filepath.Join(dir, "trace.log"), LogFormat: logFormatText}
+	tr, err := newTracer(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := qnameMessage(t, "example.com.")
+	m.Type = dnstap.Dnstap_MESSAGE.Enum()
+	m.Message.Type = dnstap.Message_RESOLVER_RESPONSE.Enum()
+	tr.LogDnstap("Submitting response", m)
+
+	b, err := ioutil.ReadFile(conf.TraceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "msg=\"Submitting response\"") {
+		t.Errorf("trace file missing record:\n%s", b)
+	}
+	if stderr.Len() > 0 {
+		t.Errorf("trace written to default logger:\n%s", stderr)
+	}
+}
@@ -10,12 +10,20 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/xeipuuv/gojsonschema"
 	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 var schemaYaml = []byte(`
@@ -24,6 +32,10 @@ $schema: http://json-schema.org/draft-04/schema#
 description: dnstap sensor configuration
 type: object
 properties:
+    include:
+        type: [ string, array ]
+        items:
+            type: string
     servers:
         type: array
         items:
@@ -31,9 +43,58 @@ properties:
             format: uri
     udp_output:
         type: string
+        format: udp-address
+    udp_outputs: &udp_outputs
+        type: array
+        items:
+            type: object
+            properties:
+                address:
+                    type: string
+                    format: udp-address
+                mtu:
+                    type: integer
+                    minimum: 512
+                    maximum: 1048576
+                flush:
+                    type: string
+                    format: duration
+                multicast_ttl:
+                    type: integer
+                    minimum: 0
+                    maximum: 255
+                multicast_interface:
+                    type: string
+                multicast_loopback:
+                    type: boolean
+            required: [ address ]
+            additionalProperties: false
+    sharded_outputs: &sharded_outputs
+        type: array
+        items:
+            type: object
+            properties:
+                key:
+                    type: string
+                    enum: [ qname, response_address ]
+                destinations:
+                    type: array
+                    minItems: 1
+                    items:
+                        type: string
+                        format: udp-address
+                mtu:
+                    type: integer
+                    minimum: 512
+                    maximum: 1048576
+                flush:
+                    type: string
+                    format: duration
+            required: [ destinations ]
+            additionalProperties: false
     mtu:
         type: integer
-        mininum: 512
+        minimum: 512
         maximum: 1048576
     api_key:
         type: string
@@ -42,19 +103,117 @@ properties:
         minimum: 1
     dnstap_input:
         type: string
+    input_socket_mode:
+        type: [ string, integer ]
+        pattern: "^0?[0-7]{3}$"
+        minimum: 0
+        maximum: 511
+    input_socket_group:
+        type: string
+    input_socket_remove:
+        type: boolean
+    user:
+        type: string
+    group:
+        type: string
     stats_interval:
         type: string
+        format: duration
     heartbeat:
         type: string
+        format: duration
     retry:
         type: string
+        format: duration
     flush:
         type: string
-    filter_qnames:
+        format: duration
+    filter_qnames: &filter_qnames
         type: array
         items:
             type: string
             format: hostname
+    pipelines:
+        type: array
+        items:
+            type: object
+            properties:
+                name:
+                    type: string
+                    minLength: 1
+                inputs:
+                    type: array
+                    items:
+                        type: string
+                        minLength: 1
+                input_idle:
+                    type: string
+                    format: duration
+                message_types:
+                    type: array
+                    items:
+                        type: string
+                        enum: [ auth_query, auth_response,
+                                resolver_query, resolver_response,
+                                client_query, client_response,
+                                forwarder_query, forwarder_response,
+                                stub_query, stub_response,
+                                tool_query, tool_response,
+                                update_query, update_response ]
+                filter_qnames: *filter_qnames
+                transforms:
+                    type: array
+                    items:
+                        type: string
+                        enum: [ strip_query_address, strip_query_message, strip_identity ]
+                upload:
+                    type: boolean
+                udp_outputs: *udp_outputs
+                sharded_outputs: *sharded_outputs
+            required: [ name ]
+            additionalProperties: false
+    trace:
+        type: boolean
+    trace_sample:
+        type: integer
+        minimum: 0
+    trace_rate:
+        type: integer
+        minimum: 0
+    trace_qnames:
+        type: array
+        items:
+            type: string
+            format: hostname
+    trace_file:
+        type: string
+    tls_ca_file:
+        type: string
+    tls_cert_file:
+        type: string
+    tls_key_file:
+        type: string
+    tls_pin_sha256:
+        type: array
+        items:
+            type: string
+    proxy:
+        type: string
+        format: uri
+    metrics_listen:
+        type: string
+    input_idle:
+        type: string
+        format: duration
+    shutdown_timeout:
+        type: string
+        format: duration
+    log_level:
+        type: string
+        enum: [ debug, info, warn, error ]
+    log_format:
+        type: string
+        enum: [ text, json ]
 additionalProperties: false
 `)
 var schema *gojsonschema.Schema
@@ -98,13 +257,71 @@ func stringifySlice(in []interface{}) []interface{} {
 	return ret
 }
 
-func init() {
+// durationFormat checks strings in the time.ParseDuration format.
+type durationFormat struct{}
+
+func (durationFormat) IsFormat(input interface{}) bool {
+	s, ok := input.(string)
+	if !ok {
+		return true
+	}
+	_, err := time.ParseDuration(s)
+	return err == nil
+}
+
+// udpAddressFormat checks UDP addresses of the form udp:<host>:<port>,
+// where udp may be replaced by udp4 or udp6. Host names are not resolved.
+type udpAddressFormat struct{}
+
+func (udpAddressFormat) IsFormat(input interface{}) bool {
+	s, ok := input.(string)
+	if !ok {
+		return true
+	}
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return false
+	}
+	switch s[:i] {
+	case "udp", "udp4", "udp6":
+	default:
+		return false
+	}
+	host, port, err := net.SplitHostPort(s[i+1:])
+	if err != nil || host == "" {
+		return false
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	return err == nil && n > 0
+}
+
+// schemaObject returns the configuration schema as a JSON-compatible
+// object.
+func schemaObject() map[string]interface{} {
 	var schemaObject map[interface{}]interface{}
 	err := yaml.Unmarshal(schemaYaml, &schemaObject)
 	if err != nil {
 		log.Fatal("init-yaml: ", err)
 	}
-	loader := gojsonschema.NewGoLoader(stringifyMap(schemaObject))
+	return stringifyMap(schemaObject)
+}
+
+// printSchema writes the configuration schema to w in JSON format.
+func printSchema(w io.Writer) error {
+	b, err := json.MarshalIndent(schemaObject(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+func init() {
+	gojsonschema.FormatCheckers.Add("duration", durationFormat{})
+	gojsonschema.FormatCheckers.Add("udp-address", udpAddressFormat{})
+
+	var err error
+	loader := gojsonschema.NewGoLoader(schemaObject())
 	schema, err = gojsonschema.NewSchema(loader)
 	if err != nil {
 		log.Fatalf("init-schema: %#v", err)
@@ -123,7 +340,15 @@ func (e errList) Error() string {
 
 // Validate parses the configuration contents in the supplied buffer and
 // returns nil if it is a valid config, or an appropriate error otherwise.
+// Errors give the line and column of the offending setting.
 func Validate(b []byte) error {
+	return validate(b, true)
+}
+
+// validate validates the configuration in b, locating any errors in b if
+// locate is true. Configurations generated from environment variables or
+// command line options are validated without locating errors.
+func validate(b []byte, locate bool) error {
 	var configObject map[interface{}]interface{}
 	err := yaml.Unmarshal(b, &configObject)
 	if err != nil {
@@ -137,9 +362,81 @@ func Validate(b []byte) error {
 		return nil
 	}
 
+	var root *yamlv3.Node
+	if locate {
+		var doc yamlv3.Node
+		if yamlv3.Unmarshal(b, &doc) == nil && len(doc.Content) > 0 {
+			root = doc.Content[0]
+		}
+	}
+	errs := res.Errors()
+	nodes := make(map[gojsonschema.ResultError]*yamlv3.Node)
+	for _, err := range errs {
+		nodes[err] = locateError(root, err)
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		ni, nj := nodes[errs[i]], nodes[errs[j]]
+		if ni == nil || nj == nil {
+			return nj == nil && ni != nil
+		}
+		if ni.Line != nj.Line {
+			return ni.Line < nj.Line
+		}
+		return ni.Column < nj.Column
+	})
+
 	errbuf := new(bytes.Buffer)
-	for _, err := range res.Errors() {
+	for _, err := range errs {
+		if n := nodes[err]; n != nil {
+			fmt.Fprintf(errbuf, "line %d, column %d: ", n.Line, n.Column)
+		}
 		fmt.Fprintf(errbuf, "%s\n", err)
 	}
 	return errors.New(errbuf.String())
 }
+
+// locateError returns the YAML node under root at which the schema
+// validation error err occurred, or nil if it cannot be found.
+func locateError(root *yamlv3.Node, err gojsonschema.ResultError) *yamlv3.Node {
+	if root == nil {
+		return nil
+	}
+	var path []string
+	if f := err.Field(); f != gojsonschema.STRING_ROOT_SCHEMA_PROPERTY {
+		path = strings.Split(f, ".")
+	}
+	key := false
+	if err.Type() == "additional_property_not_allowed" {
+		// Locate the disallowed key rather than its parent.
+		if p, ok := err.Details()["property"].(string); ok {
+			path = append(path, p)
+			key = true
+		}
+	}
+
+	n := root
+	for j, p := range path {
+		var next *yamlv3.Node
+		switch n.Kind {
+		case yamlv3.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == p {
+					next = n.Content[i+1]
+					if key && j == len(path)-1 {
+						next = n.Content[i]
+					}
+					break
+				}
+			}
+		case yamlv3.SequenceNode:
+			if i, err := strconv.Atoi(p); err == nil && i >= 0 && i < len(n.Content) {
+				next = n.Content[i]
+			}
+		}
+		if next == nil {
+			return n
+		}
+		n = next
+	}
+	return n
+}
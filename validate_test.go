@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2026 Farsight Security, Inc.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateFormats(t *testing.T) {
+	testCases := []struct {
+		Checker interface{ IsFormat(interface{}) bool }
+		Input   string
+		Valid   bool
+	}{
+		{durationFormat{}, "500ms", true},
+		{durationFormat{}, "1h30m", true},
+		{durationFormat{}, "30", false},
+		{durationFormat{}, "30 seconds", false},
+		{udpAddressFormat{}, "udp:127.0.0.1:5353", true},
+		{udpAddressFormat{}, "udp6:[ff15::1]:5353", true},
+		{udpAddressFormat{}, "udp4:collector.example.com:5353", true},
+		{udpAddressFormat{}, "127.0.0.1:5353", false},
+		{udpAddressFormat{}, "tcp:127.0.0.1:5353", false},
+		{udpAddressFormat{}, "udp:127.0.0.1", false},
+		{udpAddressFormat{}, "udp:127.0.0.1:0", false},
+		{udpAddressFormat{}, "udp:127.0.0.1:65536", false},
+	}
+	for _, tc := range testCases {
+		if tc.Checker.IsFormat(tc.Input) != tc.Valid {
+			t.Errorf("%T(%q) != %v", tc.Checker, tc.Input, tc.Valid)
+		}
+	}
+}
+
+func TestValidateLocation(t *testing.T) {
+	err := Validate([]byte(`channel: 25
+udp_outputs:
+  - address: udp:127.0.0.1:5353
+    mtu: 100
+stats_interval: 15 minutes
+bogus: true
+`))
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	lines := strings.Split(strings.TrimSpace(err.Error()), "\n")
+	expect := []string{
+		"line 4, column 10: udp_outputs.0.mtu: ",
+		"line 5, column 17: stats_interval: ",
+		"line 6, column 1: (root): Additional property bogus",
+	}
+	if len(lines) != len(expect) {
+		t.Fatalf("expected %d errors, got:\n%s", len(expect), err)
+	}
+	for i, e := range expect {
+		if !strings.HasPrefix(lines[i], e) {
+			t.Errorf("error %q, expected prefix %q", lines[i], e)
+		}
+	}
+}
+
+func TestPrintSchema(t *testing.T) {
+	var out bytes.Buffer
+	if err := printSchema(&out); err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		Properties map[string]interface{} `json:"properties"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	for key := range configKeys {
+		if _, ok := s.Properties[key]; !ok {
+			t.Errorf("schema missing %s", key)
+		}
+	}
+}
@@ -9,6 +9,9 @@
 package main
 
 import (
+	"errors"
+	"time"
+
 	"github.com/farsightsec/sielink"
 	"github.com/golang/protobuf/proto"
 )
@@ -25,26 +28,47 @@ type payloadWriter struct {
 	ctx          *Context
 	channel      *uint32
 	writeChannel chan *sielink.Payload
+	done         chan struct{}
 }
 
 func newPayloadWriter(ctx *Context) *payloadWriter {
 	wchan := make(chan *sielink.Payload, 1)
+	ctx.metrics.Register("upload_queue_length", gaugeMetric,
+		"Payloads waiting to be sent to servers.", nil,
+		func() float64 { return float64(len(wchan)) })
 	res := &payloadWriter{
 		ctx:          ctx,
 		writeChannel: wchan,
 		channel:      proto.Uint32(ctx.Config.Channel),
+		done:         make(chan struct{}),
 	}
 	go func() {
+		defer close(res.done)
 		for p := range wchan {
-			traceMsg(ctx, "Sending payload: len=%d loss=%d payloads",
-				len(p.GetData()),
-				p.GetLinkLoss().GetPayloads())
+			traceMsg(ctx, "Sending payload",
+				"len", len(p.GetData()),
+				"loss", p.GetLinkLoss().GetPayloads())
 			ctx.Client.Send(p)
 		}
 	}()
 	return res
 }
 
+var errUploadTimeout = errors.New("timed out sending queued payload")
+
+// Close stops the writer once any queued payload has been sent, waiting
+// until deadline for the client to accept it. The writer must not be
+// written to after Close.
+func (c *payloadWriter) Close(deadline time.Time) error {
+	close(c.writeChannel)
+	select {
+	case <-c.done:
+		return nil
+	case <-time.After(time.Until(deadline)):
+		return errUploadTimeout
+	}
+}
+
 func (c *payloadWriter) sendPayload(p *sielink.Payload) {
 	for {
 		// Note: this presumes cap(c.writeChannel) == 1
@@ -52,13 +76,11 @@ func (c *payloadWriter) sendPayload(p *sielink.Payload) {
 		// case needs to be moved under a default: case.
 		select {
 		case c.writeChannel <- p:
-			c.ctx.NmsgUp.Messages++
-			c.ctx.NmsgUp.Bytes += uint64(len(p.GetData()))
+			c.ctx.NmsgUp.Add(uint64(len(p.GetData())))
 			return
 		case discard := <-c.writeChannel:
 			p.RecordDiscard(discard)
-			c.ctx.NmsgDiscard.Messages++
-			c.ctx.NmsgDiscard.Bytes += uint64(len(discard.GetData()))
+			c.ctx.NmsgDiscard.Add(uint64(len(discard.GetData())))
 		}
 	}
 }